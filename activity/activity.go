@@ -0,0 +1,173 @@
+// Package activity describes what a player did in a session, as a log of
+// controller button changes, and replays it on a headless console.
+package activity
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fogleman/nes/nes"
+)
+
+// ErrStateMismatch is returned by Verify when replaying a session does not
+// lead to the state it claims.
+var ErrStateMismatch = errors.New("replay does not reach the claimed state")
+
+// ErrTooLong is returned by Verify for sessions longer than the limit.
+var ErrTooLong = errors.New("session is too long")
+
+// ErrFault is returned by Verify when the replay makes the emulator fail, as
+// a bad ROM or state can, for example with an access no mapper handles.
+var ErrFault = errors.New("replay faulted")
+
+// Console events that an action can carry instead of a button change.
+const (
+	EventButton     = iota // press or release Button on Port
+	EventReset             // press the reset button
+	EventPower             // turn the console off and on
+	EventDisk              // insert side Button of the disk
+	EventZapper            // plug a Zapper into the second port
+	EventAim               // aim the Zapper at X, Y and pull its trigger if Press
+	EventFourPlayer        // plug in the four player adapter Button
+)
+
+// Ports is the number of controllers an action can address.
+const Ports = 4
+
+// Action changes the console's input, then runs it for Duration CPU cycles.
+// Usually it presses or releases a button of the controller in Port: 0 and 1
+// for the controllers in the first and second port, and 2 and 3 for the
+// third and fourth controllers of a four player adapter. Event selects a
+// console event instead; EventFourPlayer takes one of the nes.FourPlayer
+// constants as its Button. Zapper coordinates are screen pixels, and -1, -1
+// points the gun away from the screen.
+type Action struct {
+	Button   uint8
+	Press    bool
+	Duration uint32
+	Port     uint8 `json:",omitempty"`
+	Event    uint8 `json:",omitempty"`
+	X        int16 `json:",omitempty"`
+	Y        int16 `json:",omitempty"`
+}
+
+// Cycles returns the total duration of the actions.
+func Cycles(actions []Action) uint64 {
+	var cycles uint64
+	for _, action := range actions {
+		cycles += uint64(action.Duration)
+	}
+	return cycles
+}
+
+// Replay runs the actions on a console. The buttons start released. Actions
+// end on CPU instruction boundaries, as recorded, so the console stops
+// exactly where the recording did.
+func Replay(console *nes.Console, actions []Action) error {
+	var buttons [Ports][8]bool
+	// the controllers other than the first are left alone until they are used
+	used := [Ports]bool{true}
+	controllers := [Ports]*nes.Controller{
+		console.Controller1, console.Controller2, console.Controller3, console.Controller4,
+	}
+	zapper, _ := console.Port2.(*nes.Zapper)
+	var cycles, target uint64
+	for _, action := range actions {
+		switch action.Event {
+		case EventButton:
+			if action.Button >= 8 || action.Port >= Ports {
+				return ErrInvalidAction
+			}
+			buttons[action.Port][action.Button] = action.Press
+			used[action.Port] = true
+		case EventReset:
+			console.Reset()
+		case EventPower:
+			if err := console.Power(); err != nil {
+				return err
+			}
+		case EventDisk:
+			if err := console.InsertDisk(int(action.Button)); err != nil {
+				return err
+			}
+		case EventZapper:
+			zapper = nes.NewZapper(console)
+			console.Port2 = zapper
+		case EventAim:
+			if zapper == nil {
+				return ErrInvalidAction
+			}
+			zapper.Aim(int(action.X), int(action.Y))
+			zapper.SetTrigger(action.Press)
+		case EventFourPlayer:
+			if action.Button > nes.FourPlayerFamicom {
+				return ErrInvalidAction
+			}
+			console.SetFourPlayer(int(action.Button))
+			zapper = nil
+		default:
+			return ErrInvalidAction
+		}
+		for i, controller := range controllers {
+			if used[i] {
+				controller.SetButtons(buttons[i])
+			}
+		}
+		target += uint64(action.Duration)
+		for cycles < target {
+			cycles += uint64(console.Step())
+		}
+	}
+	return nil
+}
+
+// Session is an activity log with the states it starts and ends in, each
+// named by the Keccak-256 hash of its serialization.
+type Session struct {
+	Static   common.Hash `json:"static"` // cartridge state
+	Start    common.Hash `json:"start"`  // dynamic state before the activity
+	End      common.Hash `json:"end"`    // dynamic state after the activity
+	Activity []Action    `json:"activity"`
+}
+
+// Verify replays a session on a headless console booted from the static and
+// starting dynamic state, and returns the dynamic state it ends in. The APU
+// runs, as it does in the browser, because its interrupts and DMA change the
+// state of the game. Sessions longer than maxCycles are rejected without
+// being replayed, unless maxCycles is zero.
+func (s *Session) Verify(static, start []byte, maxCycles uint64) ([]byte, error) {
+	if crypto.Keccak256Hash(static) != s.Static || crypto.Keccak256Hash(start) != s.Start {
+		return nil, ErrStateMismatch
+	}
+	if maxCycles != 0 && Cycles(s.Activity) > maxCycles {
+		return nil, ErrTooLong
+	}
+	end, err := replay(static, start, s.Activity)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(end) != s.End {
+		return nil, ErrStateMismatch
+	}
+	return end, nil
+}
+
+// replay runs the actions on a headless console and returns the dynamic state
+// they end in. A panic in the emulator is returned as ErrFault.
+func replay(static, start []byte, actions []Action) (end []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			end, err = nil, fmt.Errorf("%w: %v", ErrFault, r)
+		}
+	}()
+	console, err := nes.NewHeadlessConsole(static, start, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := Replay(console, actions); err != nil {
+		return nil, err
+	}
+	return console.SerializeDynamic()
+}
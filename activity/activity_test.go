@@ -0,0 +1,190 @@
+package activity
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fogleman/nes/nes"
+)
+
+func testStates(t *testing.T) ([]byte, []byte) {
+	return testGameStates(t, 0)
+}
+
+// testGameStates returns the power on states of a cartridge of NOPs with the
+// given mapper.
+func testGameStates(t *testing.T, mapper byte) ([]byte, []byte) {
+	prg := bytes.Repeat([]byte{0xEA}, 0x4000)
+	cartridge := nes.NewCartridge(prg, make([]byte, 0x2000), mapper, nes.MirrorHorizontal, 0)
+	console, err := nes.NewConsoleFromCartridge(cartridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	static, err := console.SerializeStatic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamic, err := console.SerializeDynamic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return static, dynamic
+}
+
+func TestVerify(t *testing.T) {
+	static, start := testStates(t)
+	// record the way the browser does: set the buttons, then run for a tick
+	console, err := nes.NewHeadlessConsole(static, start, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []Action
+	var buttons [8]bool
+	for tick := 0; tick < 10; tick++ {
+		if tick%3 == 0 {
+			buttons[nes.ButtonA] = !buttons[nes.ButtonA]
+			actions = append(actions, Action{Button: nes.ButtonA, Press: buttons[nes.ButtonA]})
+		}
+		console.Controller1.SetButtons(buttons)
+		cycles := 0
+		for cycles < 1000 {
+			cycles += console.Step()
+		}
+		actions[len(actions)-1].Duration += uint32(cycles)
+	}
+	end, err := console.SerializeDynamic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := Session{
+		Static:   crypto.Keccak256Hash(static),
+		Start:    crypto.Keccak256Hash(start),
+		End:      crypto.Keccak256Hash(end),
+		Activity: actions,
+	}
+	result, err := session.Verify(static, start, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, end) {
+		t.Fatal("expected the recorded end state")
+	}
+	if _, err := session.Verify(static, start, 5000); err != ErrTooLong {
+		t.Fatalf("expected the session to be too long, got %v", err)
+	}
+	session.Activity[0].Duration += 100
+	if _, err := session.Verify(static, start, 0); err != ErrStateMismatch {
+		t.Fatalf("expected a state mismatch, got %v", err)
+	}
+}
+
+func TestVerifyFault(t *testing.T) {
+	_, start := testStates(t)
+	// a cartridge without PRG-ROM, which no honest static state holds
+	prg := bytes.Repeat([]byte{0xEA}, 0x4000)
+	cartridge := nes.NewCartridge(prg, make([]byte, 0x2000), 0, nes.MirrorHorizontal, 0)
+	console, err := nes.NewConsoleFromCartridge(cartridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cartridge.PRG = nil
+	static, err := console.SerializeStatic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := Session{
+		Static:   crypto.Keccak256Hash(static),
+		Start:    crypto.Keccak256Hash(start),
+		Activity: []Action{{Duration: 1000}},
+	}
+	if _, err := session.Verify(static, start, 0); !errors.Is(err, ErrFault) {
+		t.Fatalf("expected a fault, got %v", err)
+	}
+}
+
+func TestReplayEvents(t *testing.T) {
+	static, start := testStates(t)
+	console, err := nes.NewHeadlessConsole(static, start, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := []Action{
+		{Button: nes.ButtonStart, Press: true, Port: 1, Duration: 1000},
+		{Event: EventReset, Duration: 1000},
+		{Event: EventPower, Duration: 1000},
+	}
+	if err := Replay(console, actions); err != nil {
+		t.Fatal(err)
+	}
+	// the second controller is still held after the reset and power cycle
+	console.Controller2.Write(1)
+	console.Controller2.Write(0)
+	var value byte
+	for i := 0; i <= nes.ButtonStart; i++ {
+		value = console.Controller2.Read()
+	}
+	if value != 1 {
+		t.Fatal("expected start to be pressed on the second controller")
+	}
+	if err := Replay(console, []Action{{Event: EventDisk}}); err == nil {
+		t.Fatal("expected an error inserting a disk into a cartridge console")
+	}
+	if err := Replay(console, []Action{{Event: EventAim}}); err != ErrInvalidAction {
+		t.Fatalf("expected aiming without a Zapper to be invalid, got %v", err)
+	}
+	if err := Replay(console, []Action{{Event: EventZapper}, {Event: EventAim, X: 10, Y: 20, Press: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := console.Port2.(*nes.Zapper); !ok || console.Port2.Read()&0x10 == 0 {
+		t.Fatal("expected a Zapper with its trigger pulled in the second port")
+	}
+	actions = []Action{
+		{Event: EventFourPlayer, Button: nes.FourPlayerFamicom},
+		{Button: nes.ButtonA, Press: true, Port: 3, Duration: 1000},
+	}
+	if err := Replay(console, actions); err != nil {
+		t.Fatal(err)
+	}
+	// the fourth controller reports on bit 1 of the second port
+	console.Port2.Write(1)
+	console.Port2.Write(0)
+	if console.Port2.Read()&2 == 0 {
+		t.Fatal("expected A to be pressed on the fourth controller")
+	}
+	if err := Replay(console, []Action{{Event: EventFourPlayer, Button: 3}}); err != ErrInvalidAction {
+		t.Fatalf("expected an unknown adapter to be invalid, got %v", err)
+	}
+	if err := Replay(console, []Action{{Event: 9}}); err != ErrInvalidAction {
+		t.Fatalf("expected an invalid action, got %v", err)
+	}
+}
+
+func TestVerifyGames(t *testing.T) {
+	// the end states were hashed in a process that had saved nothing else,
+	// so a server that verified another game first must still agree
+	tests := []struct {
+		mapper byte
+		end    string
+	}{
+		{1, "0xd810e1cd9f7f14d258df7ade8fd51199861365053ec554ddf3668156a1ad19d3"},
+		{4, "0xfd09c8832ee8ec0e19f4746ebd241b5402efed2a5461777fb5ea348df2d87c4e"},
+		{0, "0xc9c5dc92b06cd7bc2cb936825a7578d5b68fe2ee23b4cfe85b01835df64c6408"},
+	}
+	for _, test := range tests {
+		static, start := testGameStates(t, test.mapper)
+		session := Session{
+			Static:   crypto.Keccak256Hash(static),
+			Start:    crypto.Keccak256Hash(start),
+			End:      common.HexToHash(test.end),
+			Activity: []Action{{Button: nes.ButtonStart, Press: true, Duration: 30000}},
+		}
+		if _, err := session.Verify(static, start, 0); err != nil {
+			t.Fatalf("mapper %d: %v", test.mapper, err)
+		}
+	}
+}
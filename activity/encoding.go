@@ -0,0 +1,163 @@
+package activity
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// EncodingVersion is the first byte of an encoded activity log. It cannot be
+// mistaken for the start of the JSON form, which is '['. Version 1 logs,
+// which have no console events, are still read.
+const EncodingVersion = 2
+
+// Each action is a byte of flags, followed by the disk side for EventDisk,
+// the adapter for EventFourPlayer or the coordinates as varints for
+// EventAim, and then its duration as a uvarint if it is not zero. For
+// console events the low bits hold the event instead of the button. The
+// port is split across two bits, the high one added in version 2.
+const (
+	actionButtonMask = 0x07
+	actionPress      = 0x08
+	actionPort1      = 0x10 // low bit of the port
+	actionEvent      = 0x20
+	actionPort2      = 0x40 // high bit of the port
+	actionDuration   = 0x80
+)
+
+var (
+	ErrEncodingVersion = errors.New("unsupported activity encoding version")
+	ErrInvalidAction   = errors.New("invalid action")
+	ErrTruncated       = errors.New("truncated activity")
+)
+
+// Encode returns the compact binary form of an activity log. Most actions
+// take a byte, plus one to three for a duration. The encoding is canonical,
+// so its hash can name the log in a preimage store.
+func Encode(actions []Action) ([]byte, error) {
+	result := make([]byte, 1, 1+len(actions)*3)
+	result[0] = EncodingVersion
+	var buffer [binary.MaxVarintLen64]byte
+	for _, action := range actions {
+		var flags byte
+		switch action.Event {
+		case EventButton:
+			if action.Button > actionButtonMask || action.Port >= Ports {
+				return nil, ErrInvalidAction
+			}
+			flags = action.Button
+			if action.Press {
+				flags |= actionPress
+			}
+			if action.Port&1 != 0 {
+				flags |= actionPort1
+			}
+			if action.Port&2 != 0 {
+				flags |= actionPort2
+			}
+		case EventReset, EventPower, EventDisk, EventZapper, EventAim, EventFourPlayer:
+			if action.Port != 0 || (action.Event != EventDisk && action.Event != EventFourPlayer && action.Button != 0) ||
+				(action.Event != EventAim && (action.Press || action.X != 0 || action.Y != 0)) {
+				return nil, ErrInvalidAction
+			}
+			flags = actionEvent | action.Event
+			if action.Press {
+				flags |= actionPress
+			}
+		default:
+			return nil, ErrInvalidAction
+		}
+		if action.Duration != 0 {
+			flags |= actionDuration
+		}
+		result = append(result, flags)
+		switch action.Event {
+		case EventDisk, EventFourPlayer:
+			result = append(result, action.Button)
+		case EventAim:
+			n := binary.PutVarint(buffer[:], int64(action.X))
+			result = append(result, buffer[:n]...)
+			n = binary.PutVarint(buffer[:], int64(action.Y))
+			result = append(result, buffer[:n]...)
+		}
+		if action.Duration != 0 {
+			n := binary.PutUvarint(buffer[:], uint64(action.Duration))
+			result = append(result, buffer[:n]...)
+		}
+	}
+	return result, nil
+}
+
+// Decode reads an activity log written by Encode.
+func Decode(data []byte) ([]Action, error) {
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+	version := data[0]
+	if version != 1 && version != EncodingVersion {
+		return nil, ErrEncodingVersion
+	}
+	actions := []Action{}
+	for i := 1; i < len(data); {
+		flags := data[i]
+		i++
+		action := Action{}
+		switch {
+		case flags&actionEvent == 0:
+			if (version == 1 && flags&actionPort2 != 0) || flags&^(actionButtonMask|actionPress|actionPort1|actionPort2|actionDuration) != 0 {
+				return nil, ErrInvalidAction
+			}
+			action.Button = flags & actionButtonMask
+			action.Press = flags&actionPress != 0
+			if flags&actionPort1 != 0 {
+				action.Port |= 1
+			}
+			if flags&actionPort2 != 0 {
+				action.Port |= 2
+			}
+		case version == 1 || flags&^(actionEvent|actionButtonMask|actionPress|actionDuration) != 0:
+			return nil, ErrInvalidAction
+		default:
+			action.Event = flags & actionButtonMask
+			action.Press = flags&actionPress != 0
+			if action.Press && action.Event != EventAim {
+				return nil, ErrInvalidAction
+			}
+			switch action.Event {
+			case EventReset, EventPower, EventZapper:
+			case EventDisk, EventFourPlayer:
+				if i >= len(data) {
+					return nil, ErrTruncated
+				}
+				action.Button = data[i]
+				i++
+			case EventAim:
+				for _, value := range []*int16{&action.X, &action.Y} {
+					v, n := binary.Varint(data[i:])
+					if n <= 0 {
+						return nil, ErrTruncated
+					}
+					if v < -1<<15 || v >= 1<<15 {
+						return nil, ErrInvalidAction
+					}
+					*value = int16(v)
+					i += n
+				}
+			default:
+				return nil, ErrInvalidAction
+			}
+		}
+		if flags&actionDuration != 0 {
+			duration, n := binary.Uvarint(data[i:])
+			if n <= 0 {
+				return nil, ErrTruncated
+			}
+			if duration == 0 || duration > 0xFFFFFFFF {
+				return nil, ErrInvalidAction
+			}
+			action.Duration = uint32(duration)
+			i += n
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
@@ -0,0 +1,92 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	// the JSON form, as returned by getActivity
+	input := []byte(`[
+		{"Button":0,"Press":false,"Duration":0},
+		{"Button":0,"Press":true,"Duration":0},
+		{"Button":7,"Press":true,"Duration":29780},
+		{"Button":3,"Press":true,"Duration":1,"Port":1},
+		{"Button":4,"Press":true,"Duration":2,"Port":2},
+		{"Button":5,"Press":false,"Duration":0,"Port":3},
+		{"Button":1,"Press":false,"Duration":6,"Event":6},
+		{"Button":0,"Press":false,"Duration":0,"Event":1},
+		{"Button":1,"Press":false,"Duration":5,"Event":3},
+		{"Button":0,"Press":false,"Duration":9,"Event":2},
+		{"Button":0,"Press":false,"Duration":0,"Event":4},
+		{"Button":0,"Press":true,"Duration":3,"Event":5,"X":255,"Y":239},
+		{"Button":0,"Press":false,"Duration":3,"Event":5,"X":-1,"Y":-1},
+		{"Button":0,"Press":false,"Duration":4294967295}
+	]`)
+	var actions []Action
+	if err := json.Unmarshal(input, &actions); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, actions) {
+		t.Fatalf("expected %v, got %v", actions, result)
+	}
+	// the JSON form is unchanged too, so its hash is
+	expected, _ := json.Marshal(actions)
+	output, _ := json.Marshal(result)
+	if !bytes.Equal(output, expected) {
+		t.Fatalf("expected %s, got %s", expected, output)
+	}
+	if len(data) >= len(expected)/4 {
+		t.Fatalf("expected the encoding to be compact, got %d bytes for %d of JSON", len(data), len(expected))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{}, ErrTruncated},
+		{[]byte{'['}, ErrEncodingVersion},
+		{[]byte{EncodingVersion, actionDuration}, ErrTruncated},
+		{[]byte{EncodingVersion, actionDuration, 0x80}, ErrTruncated},
+		{[]byte{EncodingVersion, actionDuration, 0}, ErrInvalidAction},
+		{[]byte{1, actionPort2}, ErrInvalidAction},
+		{[]byte{EncodingVersion, actionEvent | actionPort2 | EventReset}, ErrInvalidAction},
+		{[]byte{EncodingVersion, actionEvent | EventFourPlayer}, ErrTruncated},
+		{[]byte{EncodingVersion, actionEvent | 7}, ErrInvalidAction},
+		{[]byte{EncodingVersion, actionEvent | actionPress | EventReset}, ErrInvalidAction},
+		{[]byte{EncodingVersion, actionEvent | EventDisk}, ErrTruncated},
+		{[]byte{EncodingVersion, actionEvent | EventAim, 2}, ErrTruncated},
+		{[]byte{1, actionEvent | EventReset}, ErrInvalidAction},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.data); err != test.err {
+			t.Fatalf("%v: expected %v, got %v", test.data, test.err, err)
+		}
+	}
+	invalid := []Action{
+		{Button: 8},
+		{Port: 4},
+		{Event: EventFourPlayer, Port: 2},
+		{Event: EventReset, Button: 1},
+		{Event: EventReset, X: 1},
+		{Event: EventZapper, Press: true},
+		{Event: 7},
+	}
+	for _, action := range invalid {
+		if _, err := Encode([]Action{action}); err != ErrInvalidAction {
+			t.Fatalf("%v: expected an invalid action, got %v", action, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package archive indexes verified sessions. Each session links the dynamic
+// state it started from to the one it ended in, so the sessions of a game
+// form a tree of states rooted at its power-on state.
+//
+// The index is a single append-only file of JSON records, one per line,
+// which is read into memory when it is opened. A last record left incomplete
+// by a crash is dropped then.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fogleman/nes/nes"
+	"github.com/fogleman/nes/preimage"
+)
+
+// Game is the metadata of a static state.
+type Game struct {
+	Static  common.Hash `json:"static"`
+	Name    string      `json:"name,omitempty"`
+	Mapper  byte        `json:"mapper"`
+	Region  string      `json:"region"`
+	PRGSize int         `json:"prgSize"`
+}
+
+// GameFromStatic returns the metadata found in a static state. Static states
+// do not include the rom name, so Name is left empty.
+func GameFromStatic(static []byte) (Game, error) {
+	cartridge := &nes.Cartridge{}
+	if err := cartridge.LoadStatic(gob.NewDecoder(bytes.NewReader(static))); err != nil {
+		return Game{}, err
+	}
+	game := Game{
+		Static:  preimage.Hash(static),
+		Mapper:  cartridge.Mapper,
+		Region:  cartridge.Region.String(),
+		PRGSize: len(cartridge.PRG),
+	}
+	return game, nil
+}
+
+// Session is a verified session: Activity, the hash of its binary encoded
+// activity log, leads from the Start dynamic state to the End one.
+type Session struct {
+	Static   common.Hash `json:"static"`
+	Start    common.Hash `json:"start"`
+	End      common.Hash `json:"end"`
+	Activity common.Hash `json:"activity"`
+	Player   string      `json:"player,omitempty"`
+	Cycles   uint64      `json:"cycles"`
+	Time     time.Time   `json:"time"`
+}
+
+// record is a line of the index file.
+type record struct {
+	Game    *Game    `json:"game,omitempty"`
+	Session *Session `json:"session,omitempty"`
+}
+
+// Archive is an open index file.
+type Archive struct {
+	path     string
+	mu       sync.RWMutex
+	games    map[common.Hash]*Game
+	byStatic map[common.Hash][]*Session
+	byStart  map[common.Hash][]*Session
+	byEnd    map[common.Hash][]*Session
+	byPlayer map[string][]*Session
+}
+
+// Open reads the index file at path. A missing file is an empty archive; it
+// is created by the first addition.
+func Open(path string) (*Archive, error) {
+	a := &Archive{
+		path:     path,
+		games:    make(map[common.Hash]*Game),
+		byStatic: make(map[common.Hash][]*Session),
+		byStart:  make(map[common.Hash][]*Session),
+		byEnd:    make(map[common.Hash][]*Session),
+		byPlayer: make(map[string][]*Session),
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var size int64 // of the records read so far
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		var r record
+		if err == io.EOF || json.Unmarshal(line, &r) != nil {
+			if _, err := reader.Peek(1); err != io.EOF {
+				return nil, fmt.Errorf("archive: bad record at offset %d of %s", size, path)
+			}
+			// a crash while appending leaves the last record torn: drop it,
+			// so that the next record starts on a line of its own
+			log.Printf("archive: dropping the incomplete last record of %s", path)
+			if err := os.Truncate(path, size); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if r.Game != nil {
+			a.games[r.Game.Static] = r.Game
+		}
+		if r.Session != nil {
+			a.index(r.Session)
+		}
+		size += int64(len(line))
+	}
+	return a, nil
+}
+
+// AddGame records the metadata of a game. A later record replaces an
+// earlier one, except that a missing name keeps the known one.
+func (a *Archive) AddGame(game Game) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if known, ok := a.games[game.Static]; ok {
+		if game.Name == "" {
+			game.Name = known.Name
+		}
+		if *known == game {
+			return nil
+		}
+	}
+	if err := a.append(record{Game: &game}); err != nil {
+		return err
+	}
+	a.games[game.Static] = &game
+	return nil
+}
+
+// AddSession records a session. It returns false if the same activity from
+// the same state was already recorded.
+func (a *Archive) AddSession(session Session) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range a.byStart[session.Start] {
+		if s.Activity == session.Activity {
+			return false, nil
+		}
+	}
+	if err := a.append(record{Session: &session}); err != nil {
+		return false, err
+	}
+	a.index(&session)
+	return true, nil
+}
+
+// Game returns the metadata of a static state.
+func (a *Archive) Game(static common.Hash) (Game, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	game, ok := a.games[static]
+	if !ok {
+		return Game{}, false
+	}
+	return *game, true
+}
+
+// Games returns all games, sorted by name.
+func (a *Archive) Games() []Game {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	result := []Game{}
+	for _, game := range a.games {
+		result = append(result, *game)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Static.Hex() < result[j].Static.Hex()
+	})
+	return result
+}
+
+// Sessions returns the sessions of a game, oldest first.
+func (a *Archive) Sessions(static common.Hash) []Session {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return values(a.byStatic[static])
+}
+
+// PlayerSessions returns the sessions of a player, oldest first.
+func (a *Archive) PlayerSessions(player string) []Session {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return values(a.byPlayer[player])
+}
+
+// Forks returns the sessions that start from a state, oldest first.
+func (a *Archive) Forks(state common.Hash) []Session {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return values(a.byStart[state])
+}
+
+// Lineage returns the sessions that led to a state, from the first one to
+// the one that ended in it. Where several sessions reached the same state,
+// the oldest is followed. It is empty for a state that no session reached.
+func (a *Archive) Lineage(state common.Hash) []Session {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	result := []Session{}
+	seen := make(map[common.Hash]bool)
+	for !seen[state] {
+		seen[state] = true
+		sessions := a.byEnd[state]
+		if len(sessions) == 0 {
+			break
+		}
+		result = append(result, *sessions[0])
+		state = sessions[0].Start
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+func (a *Archive) index(session *Session) {
+	a.byStatic[session.Static] = append(a.byStatic[session.Static], session)
+	a.byStart[session.Start] = append(a.byStart[session.Start], session)
+	a.byEnd[session.End] = append(a.byEnd[session.End], session)
+	if session.Player != "" {
+		a.byPlayer[session.Player] = append(a.byPlayer[session.Player], session)
+	}
+}
+
+// append writes a record to the end of the index file.
+func (a *Archive) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func values(sessions []*Session) []Session {
+	result := make([]Session, len(sessions))
+	for i, session := range sessions {
+		result[i] = *session
+	}
+	return result
+}
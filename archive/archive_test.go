@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func testHash(b byte) common.Hash {
+	return common.Hash{b}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "archive.jsonl")
+
+	a, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	static := testHash(0xFF)
+	if err := a.AddGame(Game{Static: static, Name: "Test", Mapper: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddGame(Game{Static: static, Mapper: 4}); err != nil {
+		t.Fatal(err)
+	}
+	// 1 -> 2 -> 3, and a fork 2 -> 4
+	sessions := []Session{
+		{Static: static, Start: testHash(1), End: testHash(2), Activity: testHash(10), Player: "a"},
+		{Static: static, Start: testHash(2), End: testHash(3), Activity: testHash(11), Player: "b"},
+		{Static: static, Start: testHash(2), End: testHash(4), Activity: testHash(12), Player: "a"},
+	}
+	for _, session := range sessions {
+		if ok, err := a.AddSession(session); !ok || err != nil {
+			t.Fatalf("expected the session to be added, got %v %v", ok, err)
+		}
+	}
+	if ok, _ := a.AddSession(sessions[0]); ok {
+		t.Fatal("expected a duplicate session to be ignored")
+	}
+
+	// everything is read back from the file
+	a, err = Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game, ok := a.Game(static); !ok || game.Name != "Test" {
+		t.Fatalf("expected the game name to be kept, got %+v", game)
+	}
+	lineage := a.Lineage(testHash(3))
+	if len(lineage) != 2 || lineage[0].End != testHash(2) || lineage[1].End != testHash(3) {
+		t.Fatalf("unexpected lineage %+v", lineage)
+	}
+	if len(a.Lineage(testHash(1))) != 0 {
+		t.Fatal("expected the root state to have no lineage")
+	}
+	if forks := a.Forks(testHash(2)); len(forks) != 2 {
+		t.Fatalf("expected 2 forks, got %d", len(forks))
+	}
+	if n := len(a.Sessions(static)); n != 3 {
+		t.Fatalf("expected 3 sessions of the game, got %d", n)
+	}
+	if n := len(a.PlayerSessions("a")); n != 2 {
+		t.Fatalf("expected 2 sessions of the player, got %d", n)
+	}
+}
+
+func TestArchiveTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "archive.jsonl")
+
+	a, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := Session{Start: testHash(1), End: testHash(2), Activity: testHash(10)}
+	if _, err := a.AddSession(session); err != nil {
+		t.Fatal(err)
+	}
+	// a crash in the middle of the next append
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := append(data, data[:len(data)/2]...)
+	if err := ioutil.WriteFile(filename, torn, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err = Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(a.Forks(testHash(1))); n != 1 {
+		t.Fatalf("expected the complete session to be kept, got %d", n)
+	}
+	// the torn record is gone, so appending works again
+	if _, err := a.AddSession(Session{Start: testHash(2), End: testHash(3), Activity: testHash(11)}); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(a.Lineage(testHash(3))); n != 2 {
+		t.Fatalf("expected both sessions after reopening, got %d", n)
+	}
+
+	// a bad record before the last one is not a torn append
+	if err := ioutil.WriteFile(filename, append([]byte("{\n"), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(filename); err == nil {
+		t.Fatal("expected a corrupt archive to fail to open")
+	}
+}
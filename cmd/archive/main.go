@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fogleman/nes/archive"
+	"github.com/fogleman/nes/preimage"
+)
+
+var archivePath = flag.String("archive", "archive.jsonl", "session archive index")
+
+const usage = `Usage: archive [flags] command [argument]
+
+Commands:
+  games              list the games
+  sessions <static>  list the sessions of a game
+  player <name>      list the sessions of a player
+  lineage <state>    list the sessions that led to a state, oldest first
+  forks <state>      list the sessions that start from a state
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	command, argument := flag.Arg(0), flag.Arg(1)
+	if flag.NArg() != 2 && !(flag.NArg() == 1 && command == "games") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	a, err := archive.Open(*archivePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	if command == "games" {
+		for _, game := range a.Games() {
+			fmt.Fprintf(w, "%s\t%s\tmapper %d\t%s\t%dKB\n",
+				game.Static.Hex(), game.Name, game.Mapper, game.Region, game.PRGSize/1024)
+		}
+		return
+	}
+	if command == "player" {
+		printSessions(w, a.PlayerSessions(argument))
+		return
+	}
+	lookups := map[string]func(common.Hash) []archive.Session{
+		"sessions": a.Sessions,
+		"lineage":  a.Lineage,
+		"forks":    a.Forks,
+	}
+	lookup, ok := lookups[command]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	hash, err := preimage.ParseHash(argument)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printSessions(w, lookup(hash))
+}
+
+// printSessions prints a line per session: its start and end states, the
+// player, the play time at the NTSC clock rate and when it was archived.
+func printSessions(w *tabwriter.Writer, sessions []archive.Session) {
+	for _, s := range sessions {
+		played := time.Duration(float64(s.Cycles) / 1789773 * float64(time.Second))
+		fmt.Fprintf(w, "%s\t->\t%s\t%s\t%s\t%s\n", s.Start.Hex(), s.End.Hex(),
+			s.Player, played.Round(time.Second), s.Time.Format(time.RFC3339))
+	}
+}
@@ -1,15 +1,22 @@
 package cmd
 
 import (
+	"flag"
 	"io/ioutil"
 	"os"
 	"path"
-	"strings"
+
+	"github.com/fogleman/nes/nes"
 )
 
+// GetPaths returns the rom files named by the command line arguments, which
+// are those left after flag parsing if the flags have been parsed.
 func GetPaths() []string {
 	var arg string
 	args := os.Args[1:]
+	if flag.Parsed() {
+		args = flag.Args()
+	}
 	if len(args) == 1 {
 		arg = args[0]
 	} else {
@@ -27,7 +34,7 @@ func GetPaths() []string {
 		var result []string
 		for _, info := range infos {
 			name := info.Name()
-			if !strings.HasSuffix(name, ".nes") {
+			if !nes.IsCartridgeFile(name) && !nes.IsNSFFile(name) {
 				continue
 			}
 			result = append(result, path.Join(arg, name))
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/fogleman/nes/nes"
+)
+
+var output = flag.String("o", "nes/gamedb_data.go", "Go source file to write")
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gamedb [flags] nes20db.xml")
+		fmt.Fprintln(os.Stderr, "Converts the NES 2.0 XML database into the game database built into")
+		fmt.Fprintln(os.Stderr, "the nes package.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer file.Close()
+	db, err := nes.LoadGameDB(file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var buffer bytes.Buffer
+	writeSource(&buffer, db.Games())
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := ioutil.WriteFile(*output, source, 0644); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println(db.Len(), "games written to", *output)
+}
+
+func writeSource(w io.Writer, games []nes.GameInfo) {
+	fmt.Fprintln(w, "// Code generated by cmd/gamedb from nes20db.xml. DO NOT EDIT.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "package nes")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "var builtinGames = []GameInfo{")
+	for _, game := range games {
+		fmt.Fprintf(w, "\t{%q, 0x%08X, sha1Sum(\"%x\"), %d, %d, %d, %d, %d, %d, %d},\n",
+			game.Name, game.CRC32, game.SHA1, game.PRGSize, game.CHRSize,
+			game.Mapper, game.SubMapper, game.Mirror, game.Battery, game.Region)
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+var (
+	track      = flag.Int("track", 0, "track to render (1-based), or 0 for all tracks")
+	seconds    = flag.Float64("seconds", 0, "length of each track, or 0 to use the NSFe track times")
+	sampleRate = flag.Int("rate", 44100, "sample rate")
+)
+
+// default length of tracks without an NSFe track time
+const defaultSeconds = 120
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: nsf [options] input.nsf output.wav")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	nsf, err := nes.LoadNSFFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if chips := nsf.UnsupportedChips(); len(chips) > 0 {
+		log.Printf("warning: %s audio is not supported, those channels will be silent",
+			strings.Join(chips, " and "))
+	}
+	output := flag.Arg(1)
+	if *track > 0 {
+		if err := render(nsf, *track-1, output); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	base := strings.TrimSuffix(output, ".wav")
+	for song := 0; song < nsf.Songs; song++ {
+		path := fmt.Sprintf("%s-%02d.wav", base, song+1)
+		fmt.Println(path, nsf.Title(song))
+		if err := render(nsf, song, path); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func render(nsf *nes.NSF, song int, path string) error {
+	if song < 0 || song >= nsf.Songs {
+		return fmt.Errorf("invalid track: %d", song+1)
+	}
+	length := *seconds
+	if length <= 0 {
+		length = defaultSeconds
+		if ms := nsf.Duration(song); ms > 0 {
+			length = float64(ms) / 1000
+		}
+	}
+
+	player := nes.NewNSFPlayer(nsf)
+	channel := make(chan float32, *sampleRate)
+	player.Console.SetAudioChannel(channel)
+	player.Console.SetAudioSampleRate(float64(*sampleRate))
+	player.Play(song)
+
+	// run one frame at a time and drain the channel in between, so that
+	// no samples are dropped
+	count := int(length * float64(*sampleRate))
+	samples := make([]int16, 0, count)
+	for len(samples) < count {
+		player.StepSeconds(1.0 / 60)
+		for len(channel) > 0 {
+			samples = append(samples, toPCM(<-channel))
+		}
+	}
+	return writeWAV(path, samples[:count], *sampleRate)
+}
+
+func toPCM(sample float32) int16 {
+	if sample > 1 {
+		sample = 1
+	} else if sample < -1 {
+		sample = -1
+	}
+	return int16(sample * 32767)
+}
+
+func writeWAV(path string, samples []int16, sampleRate int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	size := uint32(len(samples) * 2)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + size, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(1),
+		uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, size,
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	return w.Flush()
+}
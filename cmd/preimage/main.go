@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fogleman/nes/archive"
+	"github.com/fogleman/nes/nes"
+	"github.com/fogleman/nes/preimage"
+)
+
+var (
+	dir      = flag.String("dir", "static/preimages", "preimage store directory")
+	compress = flag.Bool("gzip", false, "gzip the preimages")
+	index    = flag.String("archive", "", "session archive to record the game in, if any")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: preimage [flags] rom_file [state_file]")
+		fmt.Fprintln(os.Stderr, "Stores the static and dynamic state of a rom, at power on or from a")
+		fmt.Fprintln(os.Stderr, "save state, and prints their hashes.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	console, err := nes.NewConsole(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if flag.NArg() == 2 {
+		if err := console.LoadState(flag.Arg(1)); err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		console.Reset()
+	}
+	static, err := console.SerializeStatic()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	dynamic, err := console.SerializeDynamic()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	store := preimage.NewStore(*dir, *compress)
+	staticHash, err := store.Add(static)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	dynamicHash, err := store.Add(dynamic)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *index != "" {
+		if err := addGame(*index, static, console.Cartridge, flag.Arg(0)); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	fmt.Println("static ", staticHash.Hex())
+	fmt.Println("dynamic", dynamicHash.Hex())
+}
+
+// addGame records the game in the archive, named by the game database or
+// else by the rom file name.
+func addGame(filename string, static []byte, cartridge *nes.Cartridge, romPath string) error {
+	a, err := archive.Open(filename)
+	if err != nil {
+		return err
+	}
+	game, err := archive.GameFromStatic(static)
+	if err != nil {
+		return err
+	}
+	if cartridge.Game != nil && cartridge.Game.Name != "" {
+		game.Name = cartridge.Game.Name
+	} else {
+		_, name := path.Split(romPath)
+		game.Name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	return a.AddGame(game)
+}
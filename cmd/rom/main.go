@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"path"
-	"strings"
 
 	"github.com/fogleman/nes/nes"
 )
@@ -37,7 +36,7 @@ func main() {
 	}
 	for _, info := range infos {
 		name := info.Name()
-		if !strings.HasSuffix(name, ".nes") {
+		if !nes.IsCartridgeFile(name) {
 			continue
 		}
 		name = path.Join(dir, name)
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"github.com/fogleman/nes/cmd"
 	"github.com/fogleman/nes/ui"
 )
 
+var autoSave = flag.Bool("autosave", true, "resume games from where they were left")
+
 func main() {
 	log.SetFlags(0)
+	flag.Parse()
+	ui.AutoSave = *autoSave
 	paths := cmd.GetPaths()
 	if len(paths) == 0 {
 		log.Fatalln("no rom files specified or found")
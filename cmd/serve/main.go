@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fogleman/nes/activity"
+	"github.com/fogleman/nes/archive"
+	"github.com/fogleman/nes/preimage"
+)
+
+var (
+	addr        = flag.String("addr", "localhost:8080", "address to listen on")
+	staticDir   = flag.String("static", "static", "directory of the web front end")
+	storeDir    = flag.String("preimages", "static/preimages", "preimage store directory")
+	compress    = flag.Bool("gzip", false, "gzip new preimages")
+	archivePath = flag.String("archive", "archive.jsonl", "session archive index")
+	maxMinutes  = flag.Float64("max-minutes", 60, "longest session accepted, in minutes of NTSC play")
+	maxBody     = flag.Int64("max-body", 16<<20, "largest request body accepted, in bytes")
+)
+
+// ntscCPUFrequency converts -max-minutes to cycles. Sessions are replayed
+// whatever their region; this only bounds the work.
+const ntscCPUFrequency = 1789773
+
+// submission is the body of a session POST. Preimages carries the static and
+// starting states when the store may not have them, as for a rom loaded in
+// the browser.
+type submission struct {
+	activity.Session
+	Player    string   `json:"player"`
+	Preimages [][]byte `json:"preimages,omitempty"`
+}
+
+type server struct {
+	store     *preimage.Store
+	archive   *archive.Archive
+	replays   chan struct{} // limits the number of concurrent replays
+	maxCycles uint64
+}
+
+func main() {
+	flag.Parse()
+	a, err := archive.Open(*archivePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	s := &server{
+		store:     preimage.NewStore(*storeDir, *compress),
+		archive:   a,
+		replays:   make(chan struct{}, runtime.NumCPU()),
+		maxCycles: uint64(*maxMinutes * 60 * ntscCPUFrequency),
+	}
+	http.HandleFunc("/preimages/", s.handlePreimage)
+	http.HandleFunc("/sessions", s.handleSessions)
+	http.HandleFunc("/games", s.handleGames)
+	http.Handle("/", http.FileServer(http.Dir(*staticDir)))
+	log.Println("listening on", *addr)
+	log.Fatalln(http.ListenAndServe(*addr, isolate(http.DefaultServeMux)))
+}
+
+// isolate makes the pages it serves cross-origin isolated, which browsers
+// require before they share memory with an AudioWorklet.
+func isolate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
+		w.Header().Set("Cross-Origin-Embedder-Policy", "require-corp")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handlePreimage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hash, err := preimage.ParseHash(strings.TrimPrefix(r.URL.Path, "/preimages/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.store.Get(hash)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(hash.Hex(), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(data)
+}
+
+func (s *server) handleGames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.archive.Games())
+}
+
+// handleSessions accepts sessions, and answers queries of the archive:
+// ?game=<static hash>, ?player=<name>, ?forks=<state hash> for the sessions
+// starting from a state, or ?lineage=<state hash> for those that led to it.
+func (s *server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		s.postSession(w, r)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if player := query.Get("player"); player != "" {
+		writeJSON(w, s.archive.PlayerSessions(player))
+		return
+	}
+	lookups := []struct {
+		key    string
+		lookup func(common.Hash) []archive.Session
+	}{
+		{"game", s.archive.Sessions},
+		{"forks", s.archive.Forks},
+		{"lineage", s.archive.Lineage},
+	}
+	for _, l := range lookups {
+		if value := query.Get(l.key); value != "" {
+			hash, err := preimage.ParseHash(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, l.lookup(hash))
+			return
+		}
+	}
+	http.Error(w, "expected game, player, forks or lineage", http.StatusBadRequest)
+}
+
+// postSession accepts a session after replaying it from its starting state
+// and checking that it reaches its claimed end state. The end state and the
+// binary encoding of the activity log are added to the preimage store, and
+// the session to the archive.
+func (s *server) postSession(w http.ResponseWriter, r *http.Request) {
+	var session submission
+	body := http.MaxBytesReader(w, r.Body, *maxBody)
+	if err := json.NewDecoder(body).Decode(&session); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	static, err := s.state(session.Static, session.Preimages)
+	if err != nil {
+		http.Error(w, "static state: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, err := s.state(session.Start, session.Preimages)
+	if err != nil {
+		http.Error(w, "start state: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	actions, err := activity.Encode(session.Activity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end, err := s.verify(&session.Session, static, start)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// the submitted states are only kept once they have been replayed
+	for _, state := range []struct {
+		hash common.Hash
+		data []byte
+	}{{session.Static, static}, {session.Start, start}, {session.End, end}} {
+		if err := s.store.Put(state.hash, state.data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	actionsHash, err := s.store.Add(actions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, ok := s.archive.Game(session.Static); !ok {
+		game, err := archive.GameFromStatic(static)
+		if err == nil {
+			err = s.archive.AddGame(game)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	entry := archive.Session{
+		Static:   session.Static,
+		Start:    session.Start,
+		End:      session.End,
+		Activity: actionsHash,
+		Player:   session.Player,
+		Cycles:   activity.Cycles(session.Activity),
+		Time:     time.Now().UTC(),
+	}
+	if _, err := s.archive.AddSession(entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Println("accepted session", entry.Start.Hex(), "->", entry.End.Hex())
+	writeJSON(w, entry)
+}
+
+// state returns the preimage of a state from the store, or else from the
+// preimages submitted with a session.
+func (s *server) state(hash common.Hash, preimages [][]byte) ([]byte, error) {
+	data, err := s.store.Get(hash)
+	if !os.IsNotExist(err) {
+		return data, err
+	}
+	for _, data := range preimages {
+		if preimage.Hash(data) == hash {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// verify replays a session once one of the replay slots is free. Faults in
+// the emulator come back from Verify as errors, so a bad session is rejected
+// rather than taking the server or the slot down with it.
+func (s *server) verify(session *activity.Session, static, start []byte) ([]byte, error) {
+	s.replays <- struct{}{}
+	defer func() { <-s.replays }()
+	return session.Verify(static, start, s.maxCycles)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
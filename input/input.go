@@ -0,0 +1,275 @@
+// Package input maps keyboards and joysticks to NES controllers using a
+// bindings config shared by the desktop and browser front ends.
+//
+// Keys are named by their KeyboardEvent.code values ("KeyZ", "ArrowUp",
+// "ShiftRight", ...). Joystick inputs are named "Button<n>" for buttons and
+// "Axis<n>-" or "Axis<n>+" for the two directions of an axis.
+package input
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// Actions that can be bound, in the order of the NES button indexes followed
+// by the turbo buttons.
+var Actions = []string{
+	"A", "B", "Select", "Start", "Up", "Down", "Left", "Right", "TurboA", "TurboB",
+}
+
+// Profile binds each action to any number of inputs.
+type Profile struct {
+	Name     string              `json:"name,omitempty"` // joystick name, empty for any joystick
+	Bindings map[string][]string `json:"bindings"`
+	Menu     []string            `json:"menu,omitempty"` // inputs that together return to the menu
+}
+
+// Config is the contents of the bindings file.
+type Config struct {
+	TurboPeriod int       `json:"turboPeriod"` // frames per turbo press and release
+	Keyboard    Profile   `json:"keyboard"`
+	Joysticks   []Profile `json:"joysticks"`
+}
+
+// DefaultConfig returns the built-in bindings.
+func DefaultConfig() *Config {
+	return &Config{
+		TurboPeriod: 6,
+		Keyboard: Profile{
+			Bindings: map[string][]string{
+				"A":      {"KeyZ"},
+				"B":      {"KeyX"},
+				"Select": {"ShiftRight"},
+				"Start":  {"Enter"},
+				"Up":     {"ArrowUp"},
+				"Down":   {"ArrowDown"},
+				"Left":   {"ArrowLeft"},
+				"Right":  {"ArrowRight"},
+				"TurboA": {"KeyA"},
+				"TurboB": {"KeyS"},
+			},
+		},
+		Joysticks: []Profile{
+			{
+				Name: "PLAYSTATION(R)3 Controller",
+				Bindings: map[string][]string{
+					"A":      {"Button14"},
+					"B":      {"Button13"},
+					"Select": {"Button0"},
+					"Start":  {"Button3"},
+					"Up":     {"Button4", "Axis1-"},
+					"Down":   {"Button6", "Axis1+"},
+					"Left":   {"Button7", "Axis0-"},
+					"Right":  {"Button5", "Axis0+"},
+					"TurboA": {"Button2"},
+					"TurboB": {"Button3"},
+				},
+				Menu: []string{"Button4", "Button5"},
+			},
+			{
+				Bindings: map[string][]string{
+					"A":      {"Button0"},
+					"B":      {"Button1"},
+					"Select": {"Button6"},
+					"Start":  {"Button7"},
+					"Up":     {"Axis1-"},
+					"Down":   {"Axis1+"},
+					"Left":   {"Axis0-"},
+					"Right":  {"Axis0+"},
+					"TurboA": {"Button2"},
+					"TurboB": {"Button3"},
+				},
+				Menu: []string{"Button4", "Button5"},
+			},
+		},
+	}
+}
+
+// ParseConfig reads a config from JSON. Missing sections are taken from the
+// default config.
+func ParseConfig(data []byte) (*Config, error) {
+	config := Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	defaults := DefaultConfig()
+	if config.TurboPeriod == 0 {
+		config.TurboPeriod = defaults.TurboPeriod
+	}
+	if config.Keyboard.Bindings == nil {
+		config.Keyboard = defaults.Keyboard
+	}
+	if config.Joysticks == nil {
+		config.Joysticks = defaults.Joysticks
+	}
+	return &config, nil
+}
+
+// LoadConfig reads a config file.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// Save writes the config to a file, creating its directory if needed.
+func (c *Config) Save(filename string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, _ := path.Split(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Joystick returns the profile for the joystick with the given name: the
+// first profile with that name, or else the first one without a name.
+// Joysticks can only be told apart by name, as GLFW 3.2 has no GUIDs.
+func (c *Config) Joystick(name string) *Profile {
+	var fallback *Profile
+	for i := range c.Joysticks {
+		profile := &c.Joysticks[i]
+		if profile.Name == name {
+			return profile
+		}
+		if profile.Name == "" && fallback == nil {
+			fallback = profile
+		}
+	}
+	return fallback
+}
+
+// SetJoystick replaces the profile with the same name, or adds it.
+func (c *Config) SetJoystick(profile Profile) {
+	for i := range c.Joysticks {
+		if c.Joysticks[i].Name == profile.Name {
+			c.Joysticks[i] = profile
+			return
+		}
+	}
+	// keep named profiles ahead of the fallback
+	c.Joysticks = append([]Profile{profile}, c.Joysticks...)
+}
+
+// Turbo reports whether turbo buttons are pressed on the given frame.
+func (c *Config) Turbo(frame uint64) bool {
+	period := uint64(c.TurboPeriod)
+	if period < 2 {
+		period = 2
+	}
+	return frame%period < period/2
+}
+
+// Buttons returns the state of the NES buttons given a function that reports
+// whether an input is pressed.
+func (p *Profile) Buttons(pressed func(string) bool, turbo bool) [8]bool {
+	var result [8]bool
+	if p == nil {
+		return result
+	}
+	for i := range result {
+		result[i] = p.Pressed(Actions[i], pressed)
+	}
+	if turbo {
+		result[nes.ButtonA] = result[nes.ButtonA] || p.Pressed("TurboA", pressed)
+		result[nes.ButtonB] = result[nes.ButtonB] || p.Pressed("TurboB", pressed)
+	}
+	return result
+}
+
+// Pressed reports whether any of the inputs bound to an action is pressed.
+func (p *Profile) Pressed(action string, pressed func(string) bool) bool {
+	for _, input := range p.Bindings[action] {
+		if pressed(input) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bound reports whether an input is bound to any action, so that front ends
+// can leave it out of their own hotkeys.
+func (p *Profile) Bound(input string) bool {
+	for _, inputs := range p.Bindings {
+		for _, bound := range inputs {
+			if bound == input {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MenuPressed reports whether all of the menu inputs are pressed.
+func (p *Profile) MenuPressed(pressed func(string) bool) bool {
+	if p == nil || len(p.Menu) == 0 {
+		return false
+	}
+	for _, input := range p.Menu {
+		if !pressed(input) {
+			return false
+		}
+	}
+	return true
+}
+
+// Bind makes an input the only one bound to an action.
+func (p *Profile) Bind(action, input string) {
+	if p.Bindings == nil {
+		p.Bindings = make(map[string][]string)
+	}
+	p.Bindings[action] = []string{input}
+}
+
+// JoystickPressed reports whether a named joystick input is pressed, given
+// the joystick's button and axis state.
+func JoystickPressed(input string, buttons []byte, axes []float32) bool {
+	switch {
+	case strings.HasPrefix(input, "Button"):
+		index, err := strconv.Atoi(input[len("Button"):])
+		return err == nil && index >= 0 && index < len(buttons) && buttons[index] == 1
+	case strings.HasPrefix(input, "Axis") && len(input) > len("Axis")+1:
+		sign := input[len(input)-1]
+		index, err := strconv.Atoi(input[len("Axis") : len(input)-1])
+		if err != nil || index < 0 || index >= len(axes) {
+			return false
+		}
+		switch sign {
+		case '-':
+			return axes[index] < -0.5
+		case '+':
+			return axes[index] > 0.5
+		}
+	}
+	return false
+}
+
+// JoystickInput returns the name of the first pressed input of a joystick,
+// or an empty string if none is pressed.
+func JoystickInput(buttons []byte, axes []float32) string {
+	for i, button := range buttons {
+		if button == 1 {
+			return "Button" + strconv.Itoa(i)
+		}
+	}
+	for i, axis := range axes {
+		if axis < -0.5 {
+			return "Axis" + strconv.Itoa(i) + "-"
+		}
+		if axis > 0.5 {
+			return "Axis" + strconv.Itoa(i) + "+"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/fogleman/nes/nes"
+)
+
+func TestParseConfigDefaults(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"keyboard": {"bindings": {"A": ["KeyK"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TurboPeriod != DefaultConfig().TurboPeriod {
+		t.Fatalf("expected default turbo period, got %d", config.TurboPeriod)
+	}
+	if len(config.Joysticks) != len(DefaultConfig().Joysticks) {
+		t.Fatalf("expected default joystick profiles")
+	}
+	pressed := func(input string) bool { return input == "KeyK" }
+	buttons := config.Keyboard.Buttons(pressed, false)
+	if !buttons[nes.ButtonA] {
+		t.Fatalf("expected KeyK to press A")
+	}
+}
+
+func TestJoystickProfiles(t *testing.T) {
+	config := DefaultConfig()
+	if profile := config.Joystick("PLAYSTATION(R)3 Controller"); profile.Name == "" {
+		t.Fatalf("expected the named profile")
+	}
+	if profile := config.Joystick("Unknown Pad"); profile == nil || profile.Name != "" {
+		t.Fatalf("expected the fallback profile")
+	}
+	config.SetJoystick(Profile{Name: "Unknown Pad", Menu: []string{"Button9"}})
+	profile := config.Joystick("Unknown Pad")
+	if profile.Name != "Unknown Pad" {
+		t.Fatalf("expected the new profile")
+	}
+	buttons := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	pressed := func(input string) bool { return JoystickPressed(input, buttons, nil) }
+	if !profile.MenuPressed(pressed) {
+		t.Fatalf("expected the menu combination to be pressed")
+	}
+}
+
+func TestBound(t *testing.T) {
+	keyboard := DefaultConfig().Keyboard
+	if !keyboard.Bound("KeyA") || keyboard.Bound("KeyG") {
+		t.Fatalf("expected KeyA to be bound and KeyG not")
+	}
+	keyboard.Bind("Select", "KeyG")
+	if !keyboard.Bound("KeyG") || keyboard.Bound("ShiftRight") {
+		t.Fatalf("expected KeyG to replace ShiftRight")
+	}
+}
+
+func TestJoystickInput(t *testing.T) {
+	axes := []float32{0, -1}
+	if input := JoystickInput([]byte{0, 0}, axes); input != "Axis1-" {
+		t.Fatalf("expected Axis1-, got %q", input)
+	}
+	if !JoystickPressed("Axis1-", nil, axes) || JoystickPressed("Axis1+", nil, axes) {
+		t.Fatalf("unexpected axis state")
+	}
+	if JoystickPressed("Button3", []byte{1}, nil) {
+		t.Fatalf("out of range button should not be pressed")
+	}
+}
+
+func TestTurbo(t *testing.T) {
+	config := &Config{TurboPeriod: 4}
+	var presses int
+	for frame := uint64(0); frame < 8; frame++ {
+		if config.Turbo(frame) {
+			presses++
+		}
+	}
+	if presses != 4 {
+		t.Fatalf("expected 4 turbo frames, got %d", presses)
+	}
+}
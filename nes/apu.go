@@ -57,6 +57,7 @@ type APU struct {
 	frameValue  byte
 	frameIRQ    bool
 	filterChain FilterChain
+	expansion   ExpansionAudio
 }
 
 func NewAPU(console *Console) *APU {
@@ -66,6 +67,7 @@ func NewAPU(console *Console) *APU {
 	apu.pulse1.channel = 1
 	apu.pulse2.channel = 2
 	apu.dmc.cpu = console.CPU
+	apu.expansion, _ = console.Mapper.(ExpansionAudio)
 	return &apu
 }
 
@@ -100,8 +102,9 @@ func (apu *APU) Step() {
 	apu.cycle++
 	cycle2 := apu.cycle
 	apu.stepTimer()
-	f1 := int(float64(cycle1) / frameCounterRate)
-	f2 := int(float64(cycle2) / frameCounterRate)
+	rate := apu.console.timing().frameCounterRate
+	f1 := int(float64(cycle1) / rate)
+	f2 := int(float64(cycle2) / rate)
 	if f1 != f2 {
 		apu.stepFrameCounter()
 	}
@@ -128,6 +131,9 @@ func (apu *APU) output() float32 {
 	d := apu.dmc.output()
 	pulseOut := pulseTable[p1+p2]
 	tndOut := tndTable[3*t+2*n+d]
+	if apu.expansion != nil {
+		return pulseOut + tndOut + apu.expansion.AudioOutput()
+	}
 	return pulseOut + tndOut
 }
 
@@ -233,7 +239,7 @@ func (apu *APU) writeRegister(address uint16, value byte) {
 		apu.triangle.writeControl(value)
 	case 0x4009:
 	case 0x4010:
-		apu.dmc.writeControl(value)
+		apu.dmc.writeControl(value, apu.console.timing().dmcTable)
 	case 0x4011:
 		apu.dmc.writeValue(value)
 	case 0x4012:
@@ -248,7 +254,7 @@ func (apu *APU) writeRegister(address uint16, value byte) {
 		apu.noise.writeControl(value)
 	case 0x400D:
 	case 0x400E:
-		apu.noise.writePeriod(value)
+		apu.noise.writePeriod(value, apu.console.timing().noiseTable)
 	case 0x400F:
 		apu.noise.writeLength(value)
 	case 0x4015:
@@ -671,9 +677,9 @@ func (n *Noise) writeControl(value byte) {
 	n.envelopeStart = true
 }
 
-func (n *Noise) writePeriod(value byte) {
+func (n *Noise) writePeriod(value byte, periods []uint16) {
 	n.mode = value&0x80 == 0x80
-	n.timerPeriod = noiseTable[value&0x0F]
+	n.timerPeriod = periods[value&0x0F]
 }
 
 func (n *Noise) writeLength(value byte) {
@@ -789,10 +795,10 @@ func (d *DMC) Load(decoder *gob.Decoder) error {
 	return nil
 }
 
-func (d *DMC) writeControl(value byte) {
+func (d *DMC) writeControl(value byte, periods []byte) {
 	d.irq = value&0x80 == 0x80
 	d.loop = value&0x40 == 0x40
-	d.tickPeriod = dmcTable[value&0x0F]
+	d.tickPeriod = periods[value&0x0F]
 }
 
 func (d *DMC) writeValue(value byte) {
@@ -0,0 +1,70 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	zipFileMagic  = "PK\x03\x04"
+	gzipFileMagic = "\x1f\x8b"
+)
+
+// ExtractROM returns the ROM image stored in data. Zip archives yield the
+// entry called name, or the first ROM if name is empty, and gzip streams are
+// decompressed. Anything else is returned unchanged. 7z archives are not
+// supported, as there is no decoder for them in the standard library.
+func ExtractROM(data []byte, name string) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(zipFileMagic)):
+		return extractZip(data, name)
+	case bytes.HasPrefix(data, []byte(gzipFileMagic)):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return ioutil.ReadAll(reader)
+	}
+	return data, nil
+}
+
+func extractZip(data []byte, name string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if name == "" && !isROMFile(file.Name) {
+			continue
+		}
+		if name != "" && file.Name != name && path.Base(file.Name) != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	if name != "" {
+		return nil, fmt.Errorf("%s not found in .zip file", name)
+	}
+	return nil, errors.New("no rom found in .zip file")
+}
+
+// isArchiveFile reports whether path has an extension ExtractROM unpacks.
+func isArchiveFile(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasSuffix(path, ".zip") || strings.HasSuffix(path, ".gz")
+}
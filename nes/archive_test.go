@@ -0,0 +1,67 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func testNESImage(mapper, fill byte) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("NES\x1a")
+	buffer.Write([]byte{1, 1, mapper << 4, 0})
+	buffer.Write(make([]byte, 8))
+	buffer.Write(bytes.Repeat([]byte{fill}, 0x4000+0x2000))
+	return buffer.Bytes()
+}
+
+func TestLoadCartridgeData(t *testing.T) {
+	var zipped bytes.Buffer
+	writer := zip.NewWriter(&zipped)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"readme.txt", []byte("not a rom")},
+		{"roms/first.nes", testNESImage(2, 1)},
+		{"roms/second.nes", testNESImage(3, 2)},
+	} {
+		w, err := writer.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(entry.data)
+	}
+	writer.Close()
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write(testNESImage(7, 3))
+	gw.Close()
+
+	tests := []struct {
+		data   []byte
+		name   string
+		mapper byte
+		fill   byte
+	}{
+		{testNESImage(1, 4), "", 1, 4},
+		{zipped.Bytes(), "", 2, 1},
+		{zipped.Bytes(), "second.nes", 3, 2},
+		{zipped.Bytes(), "roms/second.nes", 3, 2},
+		{gzipped.Bytes(), "", 7, 3},
+	}
+	for _, test := range tests {
+		cartridge, err := LoadCartridgeData(test.data, test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cartridge.Mapper != test.mapper || cartridge.PRG[0] != test.fill {
+			t.Fatalf("%q: expected mapper %d, got %d", test.name, test.mapper, cartridge.Mapper)
+		}
+	}
+	if _, err := LoadCartridgeData(zipped.Bytes(), "missing.nes"); err == nil {
+		t.Fatalf("expected an error for a missing entry")
+	}
+}
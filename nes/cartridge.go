@@ -1,19 +1,94 @@
 package nes
 
-import "encoding/gob"
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
 
 type Cartridge struct {
-	PRG     []byte // PRG-ROM banks
-	CHR     []byte // CHR-ROM banks
-	SRAM    []byte // Save RAM
-	Mapper  byte   // mapper type
-	Mirror  byte   // mirroring mode
-	Battery byte   // battery present
+	PRG       []byte    // PRG-ROM banks
+	CHR       []byte    // CHR-ROM banks
+	SRAM      []byte    // Save RAM
+	Mapper    byte      // mapper type
+	SubMapper byte      // NES 2.0 submapper (board variant)
+	Mirror    byte      // mirroring mode
+	Battery   byte      // battery present
+	Disk      [][]byte  // FDS disk sides
+	Region    Region    // TV system
+	Game      *GameInfo // database entry, nil if unknown
 }
 
 func NewCartridge(prg, chr []byte, mapper, mirror, battery byte) *Cartridge {
 	sram := make([]byte, 0x2000)
-	return &Cartridge{prg, chr, sram, mapper, mirror, battery}
+	return &Cartridge{prg, chr, sram, mapper, 0, mirror, battery, nil, RegionNTSC, nil}
+}
+
+// LoadCartridge reads a .nes, .unf or .fds file, or a .zip or .gz archive
+// containing one, and returns a Cartridge on success.
+func LoadCartridge(path string) (*Cartridge, error) {
+	return LoadCartridgeEntry(path, "")
+}
+
+// LoadCartridgeEntry is like LoadCartridge, but picks the named file from a
+// .zip archive instead of the first ROM in it.
+func LoadCartridgeEntry(path, name string) (*Cartridge, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadCartridgeData(data, name)
+}
+
+// LoadCartridgeReader is like LoadCartridgeData, but reads the data from r.
+func LoadCartridgeReader(r io.Reader, name string) (*Cartridge, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LoadCartridgeData(data, name)
+}
+
+// LoadCartridgeData returns a Cartridge for a ROM image in memory. The format
+// is detected from the contents, so no file name is needed; name only selects
+// an entry of a .zip archive, with an empty name picking the first ROM.
+func LoadCartridgeData(data []byte, name string) (*Cartridge, error) {
+	data, err := ExtractROM(data, name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(nesFileMagic)):
+		return LoadNES(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte(unifFileMagic)):
+		return LoadUNIF(bytes.NewReader(data))
+	case isFDSImage(data):
+		bios, err := ioutil.ReadFile(FDSBIOSPath)
+		if err != nil {
+			return nil, err
+		}
+		return LoadFDS(data, bios)
+	}
+	if game, ok := GameDatabase.Lookup(data); ok && len(data) == game.PRGSize+game.CHRSize {
+		return game.loadHeaderless(data), nil
+	}
+	return LoadNES(bytes.NewReader(data))
+}
+
+// IsCartridgeFile reports whether path has an extension LoadCartridge reads.
+func IsCartridgeFile(path string) bool {
+	return isROMFile(path) || isArchiveFile(path)
+}
+
+func isROMFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nes", ".unf", ".unif", ".fds":
+		return true
+	}
+	return false
 }
 
 func (cartridge *Cartridge) Save(encoder *gob.Encoder) error {
@@ -35,14 +110,20 @@ func (cartridge *Cartridge) Load(decoder *gob.Decoder) error {
 func (cartridge *Cartridge) SaveStatic(encoder *gob.Encoder) error {
 	encoder.Encode(cartridge.PRG)
 	encoder.Encode(cartridge.Mapper)
+	encoder.Encode(cartridge.SubMapper)
 	encoder.Encode(cartridge.Battery)
+	encoder.Encode(cartridge.Disk)
+	encoder.Encode(cartridge.Region)
 	return nil
 }
 
 func (cartridge *Cartridge) LoadStatic(decoder *gob.Decoder) error {
 	decoder.Decode(&cartridge.PRG)
 	decoder.Decode(&cartridge.Mapper)
+	decoder.Decode(&cartridge.SubMapper)
 	decoder.Decode(&cartridge.Battery)
+	decoder.Decode(&cartridge.Disk)
+	decoder.Decode(&cartridge.Region)
 	return nil
 }
 
@@ -3,8 +3,11 @@ package nes
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"io/ioutil"
 	"os"
 	"path"
 )
@@ -22,26 +25,42 @@ type Console struct {
 	Cartridge   *Cartridge
 	Controller1 *Controller
 	Controller2 *Controller
+	Controller3 *Controller // used by four player adapters
+	Controller4 *Controller // used by four player adapters
+	Port1       InputDevice // Controller1 unless replaced
+	Port2       InputDevice // Controller2 unless replaced
 	Mapper      Mapper
 	RAM         []byte
+	cpuStepper  CPUStepper
+	rewind      *rewindBuffer // nil unless SetRewind was called
 }
 
 func NewConsole(path string) (*Console, error) {
-	cartridge, err := LoadNESFile(path)
+	cartridge, err := LoadCartridge(path)
 	if err != nil {
 		return nil, err
 	}
+	return NewConsoleFromCartridge(cartridge)
+}
+
+// NewConsoleFromCartridge returns a console for an already loaded cartridge,
+// such as one from LoadCartridgeData.
+func NewConsoleFromCartridge(cartridge *Cartridge) (*Console, error) {
 	ram := make([]byte, 2048)
 	controller1 := NewController()
 	controller2 := NewController()
+	controller3 := NewController()
+	controller4 := NewController()
 	meta := &MetaConfig{Headless: false, StepAPU: true}
 	console := Console{
-		meta, nil, nil, nil, cartridge, controller1, controller2, nil, ram}
+		meta, nil, nil, nil, cartridge, controller1, controller2, controller3,
+		controller4, controller1, controller2, nil, ram, nil, nil}
 	mapper, err := NewMapper(&console)
 	if err != nil {
 		return nil, err
 	}
 	console.Mapper = mapper
+	console.cpuStepper, _ = mapper.(CPUStepper)
 	console.CPU = NewCPU(&console)
 	console.APU = NewAPU(&console)
 	console.PPU = NewPPU(&console)
@@ -52,18 +71,57 @@ func (console *Console) Reset() {
 	console.CPU.Reset()
 }
 
+// Power turns the console off and on again. RAM and the chips start over,
+// while the cartridge keeps its SRAM and disks, and the audio output keeps
+// its settings. The CPU cycle and frame counts carry on, so that counts taken
+// before and after stay comparable.
+func (console *Console) Power() error {
+	mapper, err := NewMapper(console)
+	if err != nil {
+		return err
+	}
+	if fds, ok := console.Mapper.(*Mapper20); ok {
+		mapper.(*Mapper20).keepDisks(fds)
+	}
+	cycles := console.CPU.Cycles
+	frame := console.PPU.Frame
+	apu := console.APU
+	for i := range console.RAM {
+		console.RAM[i] = 0
+	}
+	console.Mapper = mapper
+	console.cpuStepper, _ = mapper.(CPUStepper)
+	console.CPU = NewCPU(console)
+	console.CPU.Cycles = cycles
+	console.APU = NewAPU(console)
+	console.APU.channel = apu.channel
+	console.APU.sampleRate = apu.sampleRate
+	console.APU.filterChain = apu.filterChain
+	console.PPU = NewPPU(console)
+	console.PPU.Frame = frame
+	return nil
+}
+
 func (console *Console) Step() int {
 	cpuCycles := console.CPU.Step()
-	ppuCycles := cpuCycles * 3
+	ppuCycles := console.PPU.dots(cpuCycles)
 	for i := 0; i < ppuCycles; i++ {
 		console.PPU.Step()
 		console.Mapper.Step()
 	}
+	if console.cpuStepper != nil {
+		for i := 0; i < cpuCycles; i++ {
+			console.cpuStepper.StepCPU()
+		}
+	}
 	if console.MetaConfig.StepAPU {
 		for i := 0; i < cpuCycles; i++ {
 			console.APU.Step()
 		}
 	}
+	if console.rewind != nil {
+		console.rewind.step(console)
+	}
 	return cpuCycles
 }
 
@@ -77,12 +135,50 @@ func (console *Console) StepFrame() int {
 }
 
 func (console *Console) StepSeconds(seconds float64) {
-	cycles := int(CPUFrequency * seconds)
+	cycles := int(console.CPUFrequency() * seconds)
 	for cycles > 0 {
 		cycles -= console.Step()
 	}
 }
 
+// Region returns the timing the console runs with.
+func (console *Console) Region() Region {
+	return console.Cartridge.Region
+}
+
+// SetRegion overrides the region given by the cartridge header. The region
+// is kept in the cartridge so that it is part of the static state.
+func (console *Console) SetRegion(region Region) {
+	frequency := console.CPUFrequency()
+	console.Cartridge.Region = region
+	if console.APU.sampleRate != 0 {
+		console.APU.sampleRate *= console.CPUFrequency() / frequency
+	}
+}
+
+// CPUFrequency returns the CPU clock rate of the console's region.
+func (console *Console) CPUFrequency() float64 {
+	return console.timing().cpuFrequency
+}
+
+// FrameRate returns the number of frames per second of the console's region.
+func (console *Console) FrameRate() float64 {
+	timing := console.timing()
+	dots := float64(timing.scanLines * 341)
+	if timing.skipOddFrame {
+		dots -= 0.5
+	}
+	return timing.cpuFrequency * float64(timing.ppuDots) / 5 / dots
+}
+
+func (console *Console) timing() *regionTiming {
+	region := console.Cartridge.Region
+	if int(region) >= len(regionTimings) {
+		region = RegionNTSC
+	}
+	return &regionTimings[region]
+}
+
 func (console *Console) Buffer() *image.RGBA {
 	return console.PPU.front
 }
@@ -99,6 +195,68 @@ func (console *Console) SetButtons2(buttons [8]bool) {
 	console.Controller2.SetButtons(buttons)
 }
 
+func (console *Console) SetButtons3(buttons [8]bool) {
+	console.Controller3.SetButtons(buttons)
+}
+
+func (console *Console) SetButtons4(buttons [8]bool) {
+	console.Controller4.SetButtons(buttons)
+}
+
+// SetFourPlayer plugs a four player adapter (one of the FourPlayer
+// constants) into the ports, with controllers 1 and 3 on the first port and
+// 2 and 4 on the second. FourPlayerNone plugs in controllers 1 and 2.
+func (console *Console) SetFourPlayer(adapter int) {
+	switch adapter {
+	case FourPlayerFourScore, FourPlayerFamicom:
+		famicom := adapter == FourPlayerFamicom
+		console.Port1 = &fourPlayerPort{first: console.Controller1,
+			second: console.Controller3, signature: 0x10, famicom: famicom}
+		console.Port2 = &fourPlayerPort{first: console.Controller2,
+			second: console.Controller4, signature: 0x20, famicom: famicom}
+	default:
+		console.Port1 = console.Controller1
+		console.Port2 = console.Controller2
+	}
+}
+
+// DiskSides returns the number of disk sides of a Famicom Disk System image,
+// or zero for regular cartridges.
+func (console *Console) DiskSides() int {
+	if fds, ok := console.Mapper.(*Mapper20); ok {
+		return fds.DiskSides()
+	}
+	return 0
+}
+
+// DiskSide returns the disk side in the drive, or -1 if it is empty.
+func (console *Console) DiskSide() int {
+	if fds, ok := console.Mapper.(*Mapper20); ok {
+		return fds.DiskSide()
+	}
+	return -1
+}
+
+// InsertDisk swaps the given disk side into the drive.
+func (console *Console) InsertDisk(side int) error {
+	fds, ok := console.Mapper.(*Mapper20)
+	if !ok {
+		return errors.New("not a disk system image")
+	}
+	if side < 0 || side >= fds.DiskSides() {
+		return fmt.Errorf("invalid disk side: %d", side)
+	}
+	fds.InsertDisk(side)
+	return nil
+}
+
+// EjectDisk removes the disk from the drive.
+func (console *Console) EjectDisk() {
+	if fds, ok := console.Mapper.(*Mapper20); ok {
+		fds.EjectDisk()
+	}
+}
+
 func (console *Console) SetAudioChannel(channel chan float32) {
 	console.APU.channel = channel
 }
@@ -106,7 +264,7 @@ func (console *Console) SetAudioChannel(channel chan float32) {
 func (console *Console) SetAudioSampleRate(sampleRate float64) {
 	if sampleRate != 0 {
 		// Convert samples per second to cpu steps per sample
-		console.APU.sampleRate = CPUFrequency / sampleRate
+		console.APU.sampleRate = console.CPUFrequency() / sampleRate
 		// Initialize filters
 		console.APU.filterChain = FilterChain{
 			HighPassFilter(float32(sampleRate), 90),
@@ -139,6 +297,8 @@ func (console *Console) Save(encoder *gob.Encoder) error {
 	console.PPU.Save(encoder)
 	console.Cartridge.Save(encoder)
 	console.Mapper.Save(encoder)
+	savePort(encoder, console.Port1)
+	savePort(encoder, console.Port2)
 	return encoder.Encode(true)
 }
 
@@ -159,6 +319,8 @@ func (console *Console) Load(decoder *gob.Decoder) error {
 	console.PPU.Load(decoder)
 	console.Cartridge.Load(decoder)
 	console.Mapper.Load(decoder)
+	loadPort(decoder, console.Port1)
+	loadPort(decoder, console.Port2)
 	var dummy bool
 	if err := decoder.Decode(&dummy); err != nil {
 		return err
@@ -187,6 +349,8 @@ func (console *Console) SaveDynamic(encoder *gob.Encoder) error {
 	console.PPU.Save(encoder)
 	console.Cartridge.SaveDynamic(encoder)
 	console.Mapper.Save(encoder)
+	savePort(encoder, console.Port1)
+	savePort(encoder, console.Port2)
 	return encoder.Encode(true)
 }
 
@@ -197,6 +361,8 @@ func (console *Console) LoadDynamic(decoder *gob.Decoder) error {
 	console.PPU.Load(decoder)
 	console.Cartridge.LoadDynamic(decoder)
 	console.Mapper.Load(decoder)
+	loadPort(decoder, console.Port1)
+	loadPort(decoder, console.Port2)
 	var dummy bool
 	if err := decoder.Decode(&dummy); err != nil {
 		return err
@@ -204,6 +370,43 @@ func (console *Console) LoadDynamic(decoder *gob.Decoder) error {
 	return nil
 }
 
+// stateTypes are the composite types that states are encoded with. Gob
+// numbers types in the order a process first encodes them and writes the
+// numbers into the stream, so the same state would encode differently after
+// saving a different game. Registering the types first, in a fixed order,
+// makes a state encode the same way in every process, and so gives it a
+// single hash. Types added to a Save method must be added here, which
+// TestStateTypes checks for every mapper and device.
+var stateTypes = []interface{}{
+	[2]bool{}, [3]bool{}, [8]bool{}, [12]bool{}, [72]bool{},
+	[2]byte{}, [3]byte{}, [4]byte{}, [8]byte{}, [10]byte{}, [16]byte{},
+	[32]byte{}, [64]byte{}, [128]byte{}, [256]byte{}, [2048]byte{},
+	[2]int{}, [4]int{}, [8]int{},
+	[3]uint16{}, [8]uint32{},
+	[][]byte{},
+}
+
+func init() {
+	encoder := gob.NewEncoder(ioutil.Discard)
+	for _, value := range stateTypes {
+		encoder.Encode(value)
+	}
+}
+
+// savePort encodes the state of the device in a port as a separate blob, so
+// that loading it into a different device cannot upset the rest of the state.
+func savePort(encoder *gob.Encoder, device InputDevice) {
+	var buffer bytes.Buffer
+	device.Save(gob.NewEncoder(&buffer))
+	encoder.Encode(buffer.Bytes())
+}
+
+func loadPort(decoder *gob.Decoder, device InputDevice) {
+	var data []byte
+	decoder.Decode(&data)
+	device.Load(gob.NewDecoder(bytes.NewReader(data)))
+}
+
 func (console *Console) SerializeStatic() ([]byte, error) {
 	var buffer bytes.Buffer
 	encoder := gob.NewEncoder(&buffer)
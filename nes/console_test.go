@@ -2,6 +2,7 @@ package nes
 
 import (
 	"bytes"
+	"encoding/gob"
 	"testing"
 	"time"
 )
@@ -101,3 +102,144 @@ func BenchmarkConsole(b *testing.B) {
 		})
 	}
 }
+
+func TestPower(t *testing.T) {
+	console := newTestConsole(t)
+	console.Reset()
+	console.StepFrame()
+	console.RAM[0] = 1
+	cycles := console.CPU.Cycles
+	frame := console.PPU.Frame
+	if err := console.Power(); err != nil {
+		t.Fatal(err)
+	}
+	if console.RAM[0] != 0 || console.PPU.Cycle != 340 || console.PPU.ScanLine != 240 {
+		t.Fatal("expected RAM and the PPU to start over")
+	}
+	if console.PPU.Frame != frame {
+		t.Fatalf("expected the frame count to carry on from %d, got %d", frame, console.PPU.Frame)
+	}
+	if console.CPU.Cycles != cycles || console.CPU.PC != console.CPU.Read16(0xFFFC) {
+		t.Fatalf("expected the CPU to start at the reset vector after %d cycles, got $%04X after %d",
+			cycles, console.CPU.PC, console.CPU.Cycles)
+	}
+	// disk writes and the disk in the drive survive too
+	fds, err := LoadFDS(append(newTestDisk(), newTestDisk()...), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console, err = NewConsoleFromCartridge(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Mapper.(*Mapper20).sides[0][0x1000] = 0x5A
+	if err := console.InsertDisk(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := console.Power(); err != nil {
+		t.Fatal(err)
+	}
+	m := console.Mapper.(*Mapper20)
+	if m.sides[0][0x1000] != 0x5A || m.nextSide != 1 {
+		t.Fatalf("expected the disks to be kept, got side %d next", m.nextSide)
+	}
+}
+
+// gobTypeDefs returns the numbers of the types defined in a gob stream. Gob
+// sends a type's number negated ahead of its definition, the first time an
+// encoder meets the type.
+func gobTypeDefs(data []byte) []int {
+	var ids []int
+	for len(data) > 0 {
+		length, n := gobUint(data)
+		id, _ := gobUint(data[n:])
+		if id&1 != 0 {
+			ids = append(ids, -int(^(id >> 1)))
+		}
+		data = data[n+int(length):]
+	}
+	return ids
+}
+
+func gobUint(data []byte) (uint64, int) {
+	if data[0] < 0x80 {
+		return uint64(data[0]), 1
+	}
+	n := 256 - int(data[0])
+	var value uint64
+	for _, b := range data[1 : n+1] {
+		value = value<<8 | uint64(b)
+	}
+	return value, n + 1
+}
+
+func TestStateTypes(t *testing.T) {
+	// the numbers of the types registered when the package was initialized
+	registered := make(map[int]bool)
+	for _, value := range stateTypes {
+		var buffer bytes.Buffer
+		gob.NewEncoder(&buffer).Encode(value)
+		registered[gobTypeDefs(buffer.Bytes())[0]] = true
+	}
+
+	// every mapper NewMapper knows, the disk system, the NSF player and the
+	// devices that can be plugged into the ports
+	var consoles []*Console
+	for mapper := 0; mapper < 256; mapper++ {
+		console, err := NewConsoleFromCartridge(newTestCartridge(byte(mapper), 8, 4))
+		if err == nil {
+			consoles = append(consoles, console)
+		}
+	}
+	fds, err := LoadFDS(newTestDisk(), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console, err := NewConsoleFromCartridge(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consoles = append(consoles, console)
+	nsf, err := LoadNSF(newTestNSF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consoles = append(consoles, NewNSFPlayer(nsf).Console)
+	devices := []func(*Console){
+		func(c *Console) { c.Port2 = NewZapper(c) },
+		func(c *Console) { c.Port2 = NewVaus() },
+		func(c *Console) { c.Port2 = NewPowerPad() },
+		func(c *Console) { c.Port2 = NewKeyboard() },
+		func(c *Console) { c.SetFourPlayer(FourPlayerFourScore) },
+	}
+	for _, device := range devices {
+		console := newTestConsole(t)
+		device(console)
+		consoles = append(consoles, console)
+	}
+
+	// the types a state is saved with must all be registered, whatever was
+	// encoded before in this process
+	for _, console := range consoles {
+		static, err := console.SerializeStatic()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dynamic, err := console.SerializeDynamic()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the ports are saved in streams of their own
+		var port1, port2 bytes.Buffer
+		console.Port1.Save(gob.NewEncoder(&port1))
+		console.Port2.Save(gob.NewEncoder(&port2))
+		for _, data := range [][]byte{static, dynamic, port1.Bytes(), port2.Bytes()} {
+			for _, id := range gobTypeDefs(data) {
+				if !registered[id] {
+					t.Fatalf("mapper %d (%T, %T) saves a type missing from stateTypes",
+						console.Cartridge.Mapper, console.Mapper, console.Port2)
+				}
+			}
+		}
+	}
+}
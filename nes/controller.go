@@ -1,5 +1,7 @@
 package nes
 
+import "encoding/gob"
+
 const (
 	ButtonA = iota
 	ButtonB
@@ -11,6 +13,18 @@ const (
 	ButtonRight
 )
 
+// InputDevice is a device plugged into one of the controller ports. Read
+// returns the bits it drives on $4016 or $4017, and Write receives the
+// strobe written to $4016. Save and Load handle the device's part of the
+// console state.
+type InputDevice interface {
+	Read() byte
+	Write(value byte)
+	Save(encoder *gob.Encoder) error
+	Load(decoder *gob.Decoder) error
+}
+
+// Controller is the standard pad.
 type Controller struct {
 	buttons [8]bool
 	index   byte
@@ -21,6 +35,20 @@ func NewController() *Controller {
 	return &Controller{}
 }
 
+func (c *Controller) Save(encoder *gob.Encoder) error {
+	encoder.Encode(c.buttons)
+	encoder.Encode(c.index)
+	encoder.Encode(c.strobe)
+	return nil
+}
+
+func (c *Controller) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&c.buttons)
+	decoder.Decode(&c.index)
+	decoder.Decode(&c.strobe)
+	return nil
+}
+
 func (c *Controller) SetButtons(buttons [8]bool) {
 	c.buttons = buttons
 }
@@ -0,0 +1,103 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestConsole(t *testing.T) *Console {
+	prg := bytes.Repeat([]byte{0xEA}, 0x4000)
+	cartridge := NewCartridge(prg, make([]byte, 0x2000), 0, MirrorHorizontal, 0)
+	console, err := NewConsoleFromCartridge(cartridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return console
+}
+
+func readPort(console *Console, address uint16, strobe byte, count int) []byte {
+	console.CPU.Write(0x4016, strobe|1)
+	console.CPU.Write(0x4016, strobe)
+	var values []byte
+	for i := 0; i < count; i++ {
+		values = append(values, console.CPU.Read(address))
+	}
+	return values
+}
+
+func TestVaus(t *testing.T) {
+	console := newTestConsole(t)
+	vaus := NewVaus()
+	console.Port2 = vaus
+	vaus.SetPosition(0xA5)
+	vaus.SetButton(true)
+	// $A5 = 10100101, sent inverted on bit 4
+	expected := []byte{0x08, 0x18, 0x08, 0x18, 0x18, 0x08, 0x18, 0x08}
+	if values := readPort(console, 0x4017, 0, 8); !bytes.Equal(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestPowerPad(t *testing.T) {
+	console := newTestConsole(t)
+	pad := NewPowerPad()
+	console.Port2 = pad
+	var buttons [12]bool
+	buttons[0] = true  // second read on bit 3
+	buttons[11] = true // third read on bit 4
+	pad.SetButtons(buttons)
+	expected := []byte{0x00, 0x08, 0x10, 0x00, 0x10, 0x10, 0x10, 0x10, 0x18}
+	if values := readPort(console, 0x4017, 0, 9); !bytes.Equal(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	console := newTestConsole(t)
+	keyboard := NewKeyboard()
+	console.Port2 = keyboard
+	keyboard.SetKey(KeyReturn, true)
+	keyboard.SetKey(KeyM, true)
+
+	// reset to row 0, column 0
+	console.CPU.Write(0x4016, 0x05)
+	if value := console.CPU.Read(0x4017); value != 0x1E&^0x08 {
+		t.Fatalf("row 0 column 0: got $%02X", value)
+	}
+	// column 1, then back to column 0 of the next row, three times
+	for row := 1; row <= 3; row++ {
+		console.CPU.Write(0x4016, 0x06)
+		console.CPU.Write(0x4016, 0x04)
+	}
+	console.CPU.Write(0x4016, 0x06)
+	if value := console.CPU.Read(0x4017); value != 0x1E&^0x10 {
+		t.Fatalf("row 3 column 1: got $%02X", value)
+	}
+}
+
+func TestDeviceState(t *testing.T) {
+	console := newTestConsole(t)
+	pad := NewPowerPad()
+	console.Port2 = pad
+	pad.SetButtons([12]bool{true})
+	readPort(console, 0x4017, 0, 3)
+	data, err := console.SerializeDynamic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewPowerPad()
+	console.Port2 = restored
+	if err := console.DeserializeDynamic(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.index != 3 || !restored.buttons[0] {
+		t.Fatalf("power pad state was not restored")
+	}
+
+	// loading into another device must leave the rest of the state intact
+	console.Port2 = NewZapper(console)
+	if err := console.DeserializeDynamic(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+)
+
+const (
+	fdsFileMagic = "FDS\x1a"
+	fdsSideSize  = 65500
+	fdsBIOSSize  = 0x2000
+)
+
+// FDSBIOSPath is the Famicom Disk System BIOS image (usually disksys.rom)
+// used by LoadCartridge when it is given a .fds file. The BIOS is not
+// distributed with the emulator, so it must be supplied by the user.
+var FDSBIOSPath = "disksys.rom"
+
+// LoadFDSFile reads a Famicom Disk System image (.fds), with or without the
+// fwNES header, and returns a Cartridge for the RAM adapter (mapper 20)
+// using the BIOS at biosPath.
+// https://wiki.nesdev.com/w/index.php/FDS_file_format
+func LoadFDSFile(path, biosPath string) (*Cartridge, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bios, err := ioutil.ReadFile(biosPath)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFDS(data, bios)
+}
+
+// LoadFDS builds a Famicom Disk System Cartridge from the contents of a .fds
+// image and the 8KB BIOS.
+func LoadFDS(data, bios []byte) (*Cartridge, error) {
+	if len(bios) != fdsBIOSSize {
+		return nil, errors.New("invalid FDS BIOS")
+	}
+
+	// strip fwNES header if present
+	if bytes.HasPrefix(data, []byte(fdsFileMagic)) {
+		if len(data) < 16 {
+			return nil, errors.New("invalid .fds file")
+		}
+		data = data[16:]
+	}
+
+	// split disk sides
+	if len(data) == 0 || len(data)%fdsSideSize != 0 {
+		return nil, errors.New("invalid .fds file")
+	}
+	var disk [][]byte
+	for len(data) > 0 {
+		side := make([]byte, fdsSideSize)
+		copy(side, data)
+		if side[0] != 1 || !bytes.Equal(side[1:15], []byte("*NINTENDO-HVC*")) {
+			return nil, errors.New("invalid .fds disk side")
+		}
+		disk = append(disk, side)
+		data = data[fdsSideSize:]
+	}
+
+	// the RAM adapter provides 8KB of CHR-RAM, the 32KB of PRG-RAM belongs
+	// to the mapper and the BIOS takes the place of PRG-ROM
+	prg := make([]byte, fdsBIOSSize)
+	copy(prg, bios)
+	chr := make([]byte, 0x2000)
+	cartridge := NewCartridge(prg, chr, 20, MirrorVertical, 0)
+	cartridge.Disk = disk
+	return cartridge, nil
+}
+
+// isFDSImage reports whether data looks like a .fds image, with or without
+// the fwNES header.
+func isFDSImage(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(fdsFileMagic)) ||
+		bytes.HasPrefix(data, []byte("\x01*NINTENDO-HVC*"))
+}
+
+// fdsRawSide converts a disk side from the .fds format, which only stores the
+// block contents, to the stream of bytes the drive head actually sees: each
+// block is preceded by a gap of zeros and a $80 start mark, and followed by
+// a CRC. The CRC is never checked, so a fixed value is used.
+func fdsRawSide(side []byte) []byte {
+	raw := make([]byte, 0, fdsRawSideSize)
+	raw = append(raw, make([]byte, 28300/8)...)
+	for i := 0; i < len(side); {
+		var length int
+		switch side[i] {
+		case 1: // disk info
+			length = 56
+		case 2: // file amount
+			length = 2
+		case 3: // file header
+			length = 16
+		case 4: // file data, sized by the preceding file header
+			if i < 3 {
+				return fdsPadSide(raw)
+			}
+			length = 1 + (int(side[i-3]) | int(side[i-2])<<8)
+		default:
+			return fdsPadSide(raw)
+		}
+		if i+length > len(side) {
+			length = len(side) - i
+		}
+		raw = append(raw, 0x80)
+		raw = append(raw, side[i:i+length]...)
+		raw = append(raw, 0x4D, 0x62)
+		raw = append(raw, make([]byte, 976/8)...)
+		i += length
+	}
+	return fdsPadSide(raw)
+}
+
+const fdsRawSideSize = 0x14000
+
+func fdsPadSide(raw []byte) []byte {
+	if len(raw) < fdsRawSideSize {
+		raw = append(raw, make([]byte, fdsRawSideSize-len(raw))...)
+	}
+	return raw
+}
+
+// fdsDiff returns the bytes of a disk side that differ from the original, as
+// runs of a uvarint offset from the end of the previous run, a uvarint
+// length and the new bytes. The diff of an unchanged side is empty, so that
+// saved states only carry the disk writes.
+func fdsDiff(original, side []byte) []byte {
+	if bytes.Equal(original, side) {
+		return nil
+	}
+	var diff []byte
+	var buffer [binary.MaxVarintLen64]byte
+	end := 0
+	for i := 0; i < len(side); {
+		if i < len(original) && side[i] == original[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(side) && (j >= len(original) || side[j] != original[j]) {
+			j++
+		}
+		n := binary.PutUvarint(buffer[:], uint64(i-end))
+		diff = append(diff, buffer[:n]...)
+		n = binary.PutUvarint(buffer[:], uint64(j-i))
+		diff = append(diff, buffer[:n]...)
+		diff = append(diff, side[i:j]...)
+		end = j
+		i = j
+	}
+	return diff
+}
+
+// fdsPatch applies a diff made by fdsDiff to a copy of the original side.
+func fdsPatch(original, diff []byte) []byte {
+	side := make([]byte, len(original))
+	copy(side, original)
+	end := 0
+	for len(diff) > 0 {
+		offset, n := binary.Uvarint(diff)
+		if n <= 0 {
+			break
+		}
+		length, m := binary.Uvarint(diff[n:])
+		if m <= 0 {
+			break
+		}
+		diff = diff[n+m:]
+		start := end + int(offset)
+		end = start + int(length)
+		if start < 0 || end > len(side) || int(length) > len(diff) {
+			break
+		}
+		copy(side[start:end], diff[:length])
+		diff = diff[length:]
+	}
+	return side
+}
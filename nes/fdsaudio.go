@@ -0,0 +1,305 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/FDS_audio
+
+// FDSAudio is the Famicom Disk System sound channel: a 64 step wavetable
+// with a volume envelope, and a frequency modulation unit driven by its own
+// 64 step table of pitch deltas.
+type FDSAudio struct {
+	waveTable     [64]byte
+	waveWrite     bool
+	wavePosition  byte
+	waveAccum     uint16
+	waveHalt      bool
+	envelopesHalt bool
+	frequency     uint16
+	masterVolume  byte
+	masterSpeed   byte
+	volume        fdsEnvelope
+	modEnvelope   fdsEnvelope
+	modTable      [64]byte
+	modPosition   byte
+	modFrequency  uint16
+	modAccum      uint16
+	modDisable    bool
+	modCounter    int8
+	modOutput     int
+	outputLevel   byte
+}
+
+var fdsMasterVolumeTable = [4]int{36, 24, 17, 14}
+
+var fdsModTable = [8]int{0, 1, 2, 4, 0, -4, -2, -1}
+
+func (a *FDSAudio) reset() {
+	a.masterSpeed = 0xE8
+	a.modDisable = true
+}
+
+func (a *FDSAudio) Save(encoder *gob.Encoder) error {
+	encoder.Encode(a.waveTable)
+	encoder.Encode(a.waveWrite)
+	encoder.Encode(a.wavePosition)
+	encoder.Encode(a.waveAccum)
+	encoder.Encode(a.waveHalt)
+	encoder.Encode(a.envelopesHalt)
+	encoder.Encode(a.frequency)
+	encoder.Encode(a.masterVolume)
+	encoder.Encode(a.masterSpeed)
+	a.volume.Save(encoder)
+	a.modEnvelope.Save(encoder)
+	encoder.Encode(a.modTable)
+	encoder.Encode(a.modPosition)
+	encoder.Encode(a.modFrequency)
+	encoder.Encode(a.modAccum)
+	encoder.Encode(a.modDisable)
+	encoder.Encode(a.modCounter)
+	encoder.Encode(a.modOutput)
+	encoder.Encode(a.outputLevel)
+	return nil
+}
+
+func (a *FDSAudio) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&a.waveTable)
+	decoder.Decode(&a.waveWrite)
+	decoder.Decode(&a.wavePosition)
+	decoder.Decode(&a.waveAccum)
+	decoder.Decode(&a.waveHalt)
+	decoder.Decode(&a.envelopesHalt)
+	decoder.Decode(&a.frequency)
+	decoder.Decode(&a.masterVolume)
+	decoder.Decode(&a.masterSpeed)
+	a.volume.Load(decoder)
+	a.modEnvelope.Load(decoder)
+	decoder.Decode(&a.modTable)
+	decoder.Decode(&a.modPosition)
+	decoder.Decode(&a.modFrequency)
+	decoder.Decode(&a.modAccum)
+	decoder.Decode(&a.modDisable)
+	decoder.Decode(&a.modCounter)
+	decoder.Decode(&a.modOutput)
+	decoder.Decode(&a.outputLevel)
+	return nil
+}
+
+func (a *FDSAudio) readRegister(address uint16) byte {
+	switch {
+	case address < 0x4080:
+		return a.waveTable[address&0x3F] | 0x40
+	case address == 0x4090:
+		return a.volume.gain | 0x40
+	case address == 0x4092:
+		return a.modEnvelope.gain | 0x40
+	}
+	return 0x40
+}
+
+func (a *FDSAudio) writeRegister(address uint16, value byte) {
+	switch {
+	case address < 0x4080:
+		if a.waveWrite {
+			a.waveTable[address&0x3F] = value & 0x3F
+		}
+	case address == 0x4080:
+		a.volume.write(value, a.masterSpeed)
+	case address == 0x4082:
+		a.frequency = (a.frequency & 0x0F00) | uint16(value)
+	case address == 0x4083:
+		a.frequency = (a.frequency & 0x00FF) | uint16(value&0x0F)<<8
+		a.envelopesHalt = value&0x40 == 0x40
+		a.waveHalt = value&0x80 == 0x80
+		if a.envelopesHalt {
+			a.volume.resetTimer(a.masterSpeed)
+			a.modEnvelope.resetTimer(a.masterSpeed)
+		}
+	case address == 0x4084:
+		a.modEnvelope.write(value, a.masterSpeed)
+	case address == 0x4085:
+		a.setModCounter(int(value & 0x7F))
+	case address == 0x4086:
+		a.modFrequency = (a.modFrequency & 0x0F00) | uint16(value)
+	case address == 0x4087:
+		a.modFrequency = (a.modFrequency & 0x00FF) | uint16(value&0x0F)<<8
+		a.modDisable = value&0x80 == 0x80
+		if a.modDisable {
+			a.modAccum = 0
+		}
+	case address == 0x4088:
+		// the table can only be written while modulation is disabled, and
+		// each write fills two consecutive entries
+		if a.modDisable {
+			a.modTable[a.modPosition&0x3F] = value & 0x07
+			a.modTable[(a.modPosition+1)&0x3F] = value & 0x07
+			a.modPosition = (a.modPosition + 2) & 0x3F
+		}
+	case address == 0x4089:
+		a.waveWrite = value&0x80 == 0x80
+		a.masterVolume = value & 0x03
+	case address == 0x408A:
+		a.masterSpeed = value
+	}
+}
+
+// setModCounter stores a 7-bit signed value in the modulation counter.
+func (a *FDSAudio) setModCounter(value int) {
+	value &= 0x7F
+	if value >= 64 {
+		value -= 128
+	}
+	a.modCounter = int8(value)
+}
+
+func (a *FDSAudio) modEnabled() bool {
+	return !a.modDisable && a.modFrequency > 0
+}
+
+// step is called once per CPU cycle.
+func (a *FDSAudio) step() {
+	if !a.waveHalt && !a.envelopesHalt {
+		a.volume.step(a.masterSpeed)
+		if a.modEnvelope.step(a.masterSpeed) {
+			a.updateModOutput()
+		}
+	}
+	if a.modEnabled() {
+		a.modAccum += a.modFrequency
+		if a.modAccum < a.modFrequency {
+			delta := a.modTable[a.modPosition]
+			if delta == 4 {
+				a.setModCounter(0)
+			} else {
+				a.setModCounter(int(a.modCounter) + fdsModTable[delta])
+			}
+			a.modPosition = (a.modPosition + 1) & 0x3F
+			a.updateModOutput()
+		}
+	}
+	if a.waveHalt {
+		a.wavePosition = 0
+		a.updateOutput()
+		return
+	}
+	a.updateOutput()
+	pitch := int(a.frequency)
+	if a.modEnabled() {
+		pitch += a.modOutput
+	}
+	if pitch > 0 && !a.waveWrite {
+		step := uint16(pitch)
+		a.waveAccum += step
+		if a.waveAccum < step {
+			a.wavePosition = (a.wavePosition + 1) & 0x3F
+		}
+	}
+}
+
+// updateModOutput computes the pitch offset from the modulation counter and
+// gain, following the integer arithmetic of the real hardware.
+func (a *FDSAudio) updateModOutput() {
+	counter := int(a.modCounter)
+	temp := counter * int(a.modEnvelope.gain)
+	remainder := temp & 0x0F
+	temp >>= 4
+	if remainder > 0 && temp&0x80 == 0 {
+		if counter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+	temp = int(a.frequency) * temp
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+	a.modOutput = temp
+}
+
+func (a *FDSAudio) updateOutput() {
+	if a.waveWrite {
+		// the output holds its last value while the wavetable is writable
+		return
+	}
+	gain := int(a.volume.gain)
+	if gain > 32 {
+		gain = 32
+	}
+	level := gain * fdsMasterVolumeTable[a.masterVolume]
+	a.outputLevel = byte(int(a.waveTable[a.wavePosition]) * level / 1152)
+}
+
+// output scales the 6-bit output level so that the channel at full volume is
+// about 2.4 times as loud as an APU pulse channel.
+func (a *FDSAudio) output() float32 {
+	return float32(a.outputLevel) * 0.0057
+}
+
+// fdsEnvelope is the volume or modulation gain envelope.
+type fdsEnvelope struct {
+	speed    byte
+	increase bool
+	disable  bool
+	gain     byte
+	timer    int
+}
+
+func (e *fdsEnvelope) Save(encoder *gob.Encoder) error {
+	encoder.Encode(e.speed)
+	encoder.Encode(e.increase)
+	encoder.Encode(e.disable)
+	encoder.Encode(e.gain)
+	encoder.Encode(e.timer)
+	return nil
+}
+
+func (e *fdsEnvelope) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&e.speed)
+	decoder.Decode(&e.increase)
+	decoder.Decode(&e.disable)
+	decoder.Decode(&e.gain)
+	decoder.Decode(&e.timer)
+	return nil
+}
+
+func (e *fdsEnvelope) write(value, masterSpeed byte) {
+	e.speed = value & 0x3F
+	e.increase = value&0x40 == 0x40
+	e.disable = value&0x80 == 0x80
+	e.resetTimer(masterSpeed)
+	if e.disable {
+		e.gain = e.speed
+	}
+}
+
+func (e *fdsEnvelope) resetTimer(masterSpeed byte) {
+	e.timer = 8 * (int(e.speed) + 1) * int(masterSpeed)
+}
+
+// step returns true when the gain changed.
+func (e *fdsEnvelope) step(masterSpeed byte) bool {
+	if e.disable || masterSpeed == 0 {
+		return false
+	}
+	e.timer--
+	if e.timer > 0 {
+		return false
+	}
+	e.resetTimer(masterSpeed)
+	if e.increase && e.gain < 32 {
+		e.gain++
+		return true
+	}
+	if !e.increase && e.gain > 0 {
+		e.gain--
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Four_player_adapters
+
+// Four player adapters
+const (
+	FourPlayerNone      = iota // standard controllers in both ports
+	FourPlayerFourScore        // NES Four Score or NES Satellite
+	FourPlayerFamicom          // Famicom expansion port adapter (Hori)
+)
+
+// fourPlayerPort is one port of a four player adapter. The Four Score sends
+// the reports of both of its controllers on bit 0, followed by a signature
+// identifying the port, while the Famicom adapters put the second
+// controller on bit 1.
+type fourPlayerPort struct {
+	first     *Controller
+	second    *Controller
+	signature byte
+	famicom   bool
+	index     byte
+	strobe    byte
+}
+
+func (p *fourPlayerPort) Save(encoder *gob.Encoder) error {
+	p.first.Save(encoder)
+	p.second.Save(encoder)
+	encoder.Encode(p.index)
+	encoder.Encode(p.strobe)
+	return nil
+}
+
+func (p *fourPlayerPort) Load(decoder *gob.Decoder) error {
+	p.first.Load(decoder)
+	p.second.Load(decoder)
+	decoder.Decode(&p.index)
+	decoder.Decode(&p.strobe)
+	return nil
+}
+
+func (p *fourPlayerPort) Read() byte {
+	if p.famicom {
+		return p.first.Read() | p.second.Read()<<1
+	}
+	value := byte(1)
+	switch {
+	case p.index < 8:
+		value = boolBit(p.first.buttons[p.index])
+	case p.index < 16:
+		value = boolBit(p.second.buttons[p.index-8])
+	case p.index < 24:
+		// the signature is sent most significant bit first
+		value = p.signature >> (23 - p.index) & 1
+	}
+	if p.index < 24 {
+		p.index++
+	}
+	if p.strobe&1 == 1 {
+		p.index = 0
+	}
+	return value
+}
+
+func (p *fourPlayerPort) Write(value byte) {
+	p.first.Write(value)
+	p.second.Write(value)
+	p.strobe = value
+	if p.strobe&1 == 1 {
+		p.index = 0
+	}
+}
+
+func boolBit(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
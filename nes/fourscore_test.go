@@ -0,0 +1,50 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFourScore(t *testing.T) {
+	console := newTestConsole(t)
+	console.SetButtons1([8]bool{ButtonA: true})
+	console.SetButtons2([8]bool{ButtonB: true})
+	console.SetButtons3([8]bool{ButtonStart: true})
+	console.SetButtons4([8]bool{ButtonRight: true})
+
+	read := func(address uint16, count int) []byte {
+		console.CPU.Write(0x4016, 1)
+		console.CPU.Write(0x4016, 0)
+		var bits []byte
+		for i := 0; i < count; i++ {
+			bits = append(bits, console.CPU.Read(address))
+		}
+		return bits
+	}
+
+	console.SetFourPlayer(FourPlayerFourScore)
+	expected := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // controller 1
+		0, 0, 0, 1, 0, 0, 0, 0, // controller 3
+		0, 0, 0, 1, 0, 0, 0, 0, // signature $10
+		1,
+	}
+	if bits := read(0x4016, 25); !bytes.Equal(bits, expected) {
+		t.Errorf("$4016: expected %v, got %v", expected, bits)
+	}
+	expected = []byte{
+		0, 1, 0, 0, 0, 0, 0, 0, // controller 2
+		0, 0, 0, 0, 0, 0, 0, 1, // controller 4
+		0, 0, 1, 0, 0, 0, 0, 0, // signature $20
+		1,
+	}
+	if bits := read(0x4017, 25); !bytes.Equal(bits, expected) {
+		t.Errorf("$4017: expected %v, got %v", expected, bits)
+	}
+
+	console.SetFourPlayer(FourPlayerFamicom)
+	expected = []byte{1, 0, 0, 2, 0, 0, 0, 0}
+	if bits := read(0x4016, 8); !bytes.Equal(bits, expected) {
+		t.Errorf("famicom $4016: expected %v, got %v", expected, bits)
+	}
+}
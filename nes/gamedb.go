@@ -0,0 +1,269 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GameInfo describes a known ROM dump. Dumps are identified by the CRC32 and
+// SHA-1 of their PRG-ROM followed by their CHR-ROM, without any header.
+type GameInfo struct {
+	Name      string
+	CRC32     uint32
+	SHA1      [20]byte
+	PRGSize   int
+	CHRSize   int
+	Mapper    byte
+	SubMapper byte
+	Mirror    byte
+	Battery   byte
+	Region    Region
+}
+
+// GameDB is a database of known dumps used to identify ROMs and to correct
+// the bad iNES headers that many of them come with.
+type GameDB struct {
+	byCRC32 map[uint32]*GameInfo
+	bySHA1  map[[20]byte]*GameInfo
+}
+
+// GameDatabase is consulted by the cartridge loaders. It holds the games
+// built into the package, which cmd/gamedb generates from the NES 2.0 XML
+// database, so that a ROM loads the same way, and so has the same static
+// state, on every machine.
+var GameDatabase = newBuiltinGameDB()
+
+//go:generate go run ../cmd/gamedb -o gamedb_data.go nes20db.xml
+
+func newBuiltinGameDB() *GameDB {
+	db := NewGameDB()
+	for _, game := range builtinGames {
+		db.Add(game)
+	}
+	return db
+}
+
+// sha1Sum decodes a SHA-1 sum written in hex, for the generated games.
+func sha1Sum(s string) [20]byte {
+	var sum [20]byte
+	hex.Decode(sum[:], []byte(s))
+	return sum
+}
+
+func NewGameDB() *GameDB {
+	return &GameDB{
+		byCRC32: make(map[uint32]*GameInfo),
+		bySHA1:  make(map[[20]byte]*GameInfo),
+	}
+}
+
+// Add adds or replaces an entry.
+func (db *GameDB) Add(game GameInfo) {
+	db.byCRC32[game.CRC32] = &game
+	if game.SHA1 != ([20]byte{}) {
+		db.bySHA1[game.SHA1] = &game
+	}
+}
+
+// Len returns the number of entries.
+func (db *GameDB) Len() int {
+	return len(db.byCRC32)
+}
+
+// Games returns the entries in order of CRC32 and SHA-1.
+func (db *GameDB) Games() []GameInfo {
+	seen := make(map[*GameInfo]bool)
+	var games []GameInfo
+	for _, game := range db.byCRC32 {
+		seen[game] = true
+		games = append(games, *game)
+	}
+	// entries whose CRC32 was taken by another dump
+	for _, game := range db.bySHA1 {
+		if !seen[game] {
+			games = append(games, *game)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if games[i].CRC32 != games[j].CRC32 {
+			return games[i].CRC32 < games[j].CRC32
+		}
+		return bytes.Compare(games[i].SHA1[:], games[j].SHA1[:]) < 0
+	})
+	return games
+}
+
+// Lookup finds the entry for a dump given its PRG-ROM and CHR-ROM data, in
+// that order. The SHA-1 is preferred when the entry has one, as CRC32
+// collisions do occur.
+func (db *GameDB) Lookup(roms ...[]byte) (*GameInfo, bool) {
+	if len(db.byCRC32) == 0 {
+		return nil, false
+	}
+	sha := sha1.New()
+	crc := crc32.NewIEEE()
+	for _, rom := range roms {
+		sha.Write(rom)
+		crc.Write(rom)
+	}
+	var sum [20]byte
+	sha.Sum(sum[:0])
+	if game, ok := db.bySHA1[sum]; ok {
+		return game, true
+	}
+	game, ok := db.byCRC32[crc.Sum32()]
+	if ok && game.SHA1 != ([20]byte{}) {
+		return nil, false
+	}
+	return game, ok
+}
+
+// LookupImage finds the entry for a ROM image, with or without an iNES
+// header, from its PRG-ROM and CHR-ROM alone, without loading a cartridge.
+func (db *GameDB) LookupImage(data []byte) (*GameInfo, bool) {
+	if len(data) < 16 || string(data[:4]) != nesFileMagic {
+		return db.Lookup(data)
+	}
+	rom := data[16:]
+	if data[6]&4 == 4 && len(rom) >= 512 {
+		// skip the trainer
+		rom = rom[512:]
+	}
+	size := int(data[4])*16384 + int(data[5])*8192
+	if size < len(rom) {
+		rom = rom[:size]
+	}
+	return db.Lookup(rom)
+}
+
+// apply overrides the header fields of a cartridge with those of the entry.
+func (game *GameInfo) apply(cartridge *Cartridge) {
+	cartridge.Mapper = game.Mapper
+	cartridge.SubMapper = game.SubMapper
+	cartridge.Mirror = game.Mirror
+	cartridge.Battery = game.Battery
+	cartridge.Region = game.Region
+	cartridge.Game = game
+}
+
+// loadHeaderless builds a cartridge for a known dump that has no header.
+func (game *GameInfo) loadHeaderless(rom []byte) *Cartridge {
+	prg := make([]byte, game.PRGSize)
+	copy(prg, rom)
+	chr := make([]byte, game.CHRSize)
+	copy(chr, rom[game.PRGSize:])
+	if game.CHRSize == 0 {
+		chr = make([]byte, 8192)
+	}
+	cartridge := NewCartridge(prg, chr, 0, 0, 0)
+	game.apply(cartridge)
+	return cartridge
+}
+
+type nes20dbROM struct {
+	Size  int    `xml:"size,attr"`
+	CRC32 string `xml:"crc32,attr"`
+	SHA1  string `xml:"sha1,attr"`
+}
+
+type nes20dbGame struct {
+	Comment string     `xml:",comment"`
+	PRG     nes20dbROM `xml:"prgrom"`
+	CHR     nes20dbROM `xml:"chrrom"`
+	ROM     nes20dbROM `xml:"rom"`
+	PCB     struct {
+		Mapper    int    `xml:"mapper,attr"`
+		SubMapper int    `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   int    `xml:"battery,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+// LoadGameDB parses the NES 2.0 XML database (nes20db.xml). Game names are
+// taken from the file name comment that precedes each entry.
+// https://forums.nesdev.org/viewtopic.php?t=19940
+func LoadGameDB(r io.Reader) (*GameDB, error) {
+	db := NewGameDB()
+	decoder := xml.NewDecoder(r)
+	var comment string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.Comment:
+			comment = string(token)
+		case xml.StartElement:
+			if token.Name.Local != "game" {
+				continue
+			}
+			var entry nes20dbGame
+			if err := decoder.DecodeElement(&entry, &token); err != nil {
+				return nil, err
+			}
+			if entry.Comment == "" {
+				entry.Comment = comment
+			}
+			if game, ok := entry.gameInfo(); ok {
+				db.Add(game)
+			}
+			comment = ""
+		}
+	}
+	return db, nil
+}
+
+func (entry *nes20dbGame) gameInfo() (GameInfo, bool) {
+	crc, err := strconv.ParseUint(entry.ROM.CRC32, 16, 32)
+	if err != nil {
+		return GameInfo{}, false
+	}
+	game := GameInfo{
+		Name:      nes20dbName(entry.Comment),
+		CRC32:     uint32(crc),
+		PRGSize:   entry.PRG.Size,
+		CHRSize:   entry.CHR.Size,
+		Mapper:    byte(entry.PCB.Mapper),
+		SubMapper: byte(entry.PCB.SubMapper),
+		Battery:   byte(entry.PCB.Battery),
+	}
+	if sum, err := hex.DecodeString(entry.ROM.SHA1); err == nil && len(sum) == 20 {
+		copy(game.SHA1[:], sum)
+	}
+	switch entry.PCB.Mirroring {
+	case "V":
+		game.Mirror = MirrorVertical
+	case "4":
+		game.Mirror = MirrorFour
+	}
+	switch entry.Console.Region {
+	case 1:
+		game.Region = RegionPAL
+	case 3:
+		game.Region = RegionDendy
+	}
+	return game, true
+}
+
+// nes20dbName turns a comment such as "\Licensed\Game (USA).nes" into the
+// name of the game.
+func nes20dbName(comment string) string {
+	name := strings.TrimSpace(comment)
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".nes")
+}
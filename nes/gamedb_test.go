@@ -0,0 +1,118 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGameDB(t *testing.T) {
+	// a dump with a bad header: mapper 2 with "DiskDude!" over the padding,
+	// while the database says it is a vertical mirrored PAL mapper 3 game
+	data := testNESImage(2, 5)
+	copy(data[7:], "DiskDude!")
+	rom := data[16:]
+	xmlData := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<nes20db>
+<game>
+  <!-- \Licensed\Test Game (Europe).nes -->
+  <prgrom size="16384" crc32="00000000" sha1="0000000000000000000000000000000000000000"/>
+  <chrrom size="8192" crc32="00000000" sha1="0000000000000000000000000000000000000000"/>
+  <rom size="24576" crc32="%08X" sha1="%X"/>
+  <pcb mapper="3" submapper="0" mirroring="V" battery="0"/>
+  <console type="0" region="1"/>
+</game>
+</nes20db>`, crc32.ChecksumIEEE(rom), sha1.Sum(rom))
+
+	db, err := LoadGameDB(strings.NewReader(xmlData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", db.Len())
+	}
+
+	saved := GameDatabase
+	GameDatabase = db
+	defer func() { GameDatabase = saved }()
+
+	for _, data := range [][]byte{data, rom} {
+		cartridge, err := LoadCartridgeData(data, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cartridge.Game == nil || cartridge.Game.Name != "Test Game (Europe)" {
+			t.Fatalf("expected the dump to be identified")
+		}
+		if cartridge.Mapper != 3 || cartridge.Mirror != MirrorVertical || cartridge.Region != RegionPAL {
+			t.Fatalf("unexpected cartridge: mapper %d mirror %d region %s",
+				cartridge.Mapper, cartridge.Mirror, cartridge.Region)
+		}
+		if len(cartridge.PRG) != 0x4000 || !bytes.Equal(cartridge.CHR, rom[0x4000:]) {
+			t.Fatalf("unexpected PRG/CHR split")
+		}
+	}
+}
+
+func TestGameDBGames(t *testing.T) {
+	if GameDatabase.Len() > len(builtinGames) {
+		t.Fatalf("expected at most the %d built in games, got %d", len(builtinGames), GameDatabase.Len())
+	}
+	db := NewGameDB()
+	db.Add(GameInfo{Name: "B", CRC32: 2, SHA1: sha1Sum("02")})
+	db.Add(GameInfo{Name: "A", CRC32: 1})
+	db.Add(GameInfo{Name: "C", CRC32: 2, SHA1: sha1Sum("03")}) // a CRC32 collision
+	var names []string
+	for _, game := range db.Games() {
+		names = append(names, game.Name)
+	}
+	if strings.Join(names, "") != "ABC" {
+		t.Fatalf("expected games A, B and C in order, got %v", names)
+	}
+	if sum := sha1Sum("00112233445566778899aabbccddeeff00112233"); sum[1] != 0x11 || sum[19] != 0x33 {
+		t.Fatalf("unexpected SHA-1 %x", sum)
+	}
+}
+
+func TestBuiltinGames(t *testing.T) {
+	// the generated data must match its source, as go generate leaves it
+	file, err := os.Open("nes20db.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	db, err := LoadGameDB(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if games := db.Games(); !reflect.DeepEqual(games, builtinGames) {
+		t.Fatalf("gamedb_data.go is out of date, run go generate")
+	}
+
+	// a known dump is identified, by the loader and from its image alone
+	cartridge, err := LoadCartridge("../roms/mario.nes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.Game == nil || cartridge.Game.Name != "Super Mario Bros." {
+		t.Fatalf("expected the dump to be identified, got %v", cartridge.Game)
+	}
+	data, err := ioutil.ReadFile("../roms/mario.nes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range [][]byte{data, data[16:]} {
+		if game, ok := GameDatabase.LookupImage(image); !ok || game != cartridge.Game {
+			t.Fatalf("expected the image to be identified")
+		}
+	}
+	if _, ok := GameDatabase.LookupImage(data[:len(data)-1]); ok {
+		t.Fatalf("expected a truncated image not to be identified")
+	}
+}
@@ -5,8 +5,11 @@ func NewHeadlessConsole(static []byte, dynamic []byte, stepAPU bool) (*Console,
 	ram := make([]byte, 2048)
 	controller1 := NewController()
 	controller2 := NewController()
+	controller3 := NewController()
+	controller4 := NewController()
 	meta := &MetaConfig{Headless: true, StepAPU: stepAPU}
-	console := Console{meta, nil, nil, nil, cartridge, controller1, controller2, nil, ram}
+	console := Console{meta, nil, nil, nil, cartridge, controller1, controller2,
+		controller3, controller4, controller1, controller2, nil, ram, nil, nil}
 
 	if err := console.DeserializeStatic(static); err != nil {
 		return nil, err
@@ -17,6 +20,7 @@ func NewHeadlessConsole(static []byte, dynamic []byte, stepAPU bool) (*Console,
 		return nil, err
 	}
 	console.Mapper = mapper
+	console.cpuStepper, _ = mapper.(CPUStepper)
 	console.CPU = NewCPU(&console)
 	console.APU = NewAPU(&console)
 	console.PPU = NewPPU(&console)
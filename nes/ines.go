@@ -7,7 +7,10 @@ import (
 	"os"
 )
 
-const iNESFileMagic = 0x1a53454e
+const (
+	iNESFileMagic = 0x1a53454e
+	nesFileMagic  = "NES\x1a"
+)
 
 type iNESFileHeader struct {
 	Magic    uint32  // iNES magic number
@@ -15,8 +18,10 @@ type iNESFileHeader struct {
 	NumCHR   byte    // number of CHR-ROM banks (8KB each)
 	Control1 byte    // control bits
 	Control2 byte    // control bits
-	NumRAM   byte    // PRG-RAM size (x 8KB)
-	_        [7]byte // unused padding
+	NumRAM   byte    // PRG-RAM size (x 8KB); NES 2.0: mapper MSB/submapper
+	_        [3]byte // unused padding; NES 2.0: ROM and RAM sizes
+	Timing   byte    // NES 2.0: CPU/PPU timing
+	Extra    [3]byte // unused padding; NES 2.0: expansion device etc.
 }
 
 // LoadNESFile reads an iNES file (.nes) and returns a Cartridge on success.
@@ -29,7 +34,11 @@ func LoadNESFile(path string) (*Cartridge, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return LoadNES(file)
+}
 
+// LoadNES reads an iNES image from r and returns a Cartridge on success.
+func LoadNES(file io.Reader) (*Cartridge, error) {
 	// read file header
 	header := iNESFileHeader{}
 	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
@@ -44,6 +53,12 @@ func LoadNESFile(path string) (*Cartridge, error) {
 	// mapper type
 	mapper1 := header.Control1 >> 4
 	mapper2 := header.Control2 >> 4
+	nes20 := header.Control2&0x0C == 0x08
+	if !nes20 && (header.Timing != 0 || header.Extra != [3]byte{}) {
+		// old dumping tools wrote their name (e.g. "DiskDude!") over the
+		// end of the header, which garbles the upper mapper nibble
+		mapper2 = 0
+	}
 	mapper := mapper1 | mapper2<<4
 
 	// mirroring type
@@ -54,6 +69,19 @@ func LoadNESFile(path string) (*Cartridge, error) {
 	// battery-backed RAM
 	battery := (header.Control1 >> 1) & 1
 
+	// NES 2.0 submapper and region
+	var submapper byte
+	region := RegionNTSC
+	if nes20 {
+		submapper = header.NumRAM >> 4
+		switch header.Timing & 3 {
+		case 1:
+			region = RegionPAL
+		case 3:
+			region = RegionDendy
+		}
+	}
+
 	// read trainer if present (unused)
 	if header.Control1&4 == 4 {
 		trainer := make([]byte, 512)
@@ -74,11 +102,21 @@ func LoadNESFile(path string) (*Cartridge, error) {
 		return nil, err
 	}
 
+	// look up the dump before chr-ram is added
+	game, known := GameDatabase.Lookup(prg, chr)
+
 	// provide chr-rom/ram if not in file
 	if header.NumCHR == 0 {
 		chr = make([]byte, 8192)
 	}
 
 	// success
-	return NewCartridge(prg, chr, mapper, mirror, battery), nil
+	cartridge := NewCartridge(prg, chr, mapper, mirror, battery)
+	cartridge.SubMapper = submapper
+	cartridge.Region = region
+	if known {
+		// the database is more reliable than the header
+		game.apply(cartridge)
+	}
+	return cartridge, nil
 }
@@ -0,0 +1,167 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Family_BASIC_Keyboard
+
+// Family BASIC keyboard keys. The keys are numbered by their place in the
+// matrix: nine rows of two columns of four keys.
+const (
+	KeyRightBracket = iota
+	KeyLeftBracket
+	KeyReturn
+	KeyF8
+	KeyStop
+	KeyYen
+	KeyRightShift
+	KeyKana
+
+	KeySemicolon
+	KeyColon
+	KeyAt
+	KeyF7
+	KeyCaret
+	KeyMinus
+	KeySlash
+	KeyUnderscore
+
+	KeyK
+	KeyL
+	KeyO
+	KeyF6
+	Key0
+	KeyP
+	KeyComma
+	KeyPeriod
+
+	KeyJ
+	KeyU
+	KeyI
+	KeyF5
+	Key8
+	Key9
+	KeyN
+	KeyM
+
+	KeyH
+	KeyG
+	KeyY
+	KeyF4
+	Key6
+	Key7
+	KeyV
+	KeyB
+
+	KeyD
+	KeyR
+	KeyT
+	KeyF3
+	Key4
+	Key5
+	KeyC
+	KeyF
+
+	KeyA
+	KeyS
+	KeyW
+	KeyF2
+	Key3
+	KeyE
+	KeyZ
+	KeyX
+
+	KeyControl
+	KeyQ
+	KeyEscape
+	KeyF1
+	Key2
+	Key1
+	KeyGraph
+	KeyLeftShift
+
+	KeyLeft
+	KeyRight
+	KeyUp
+	KeyClearHome
+	KeyInsert
+	KeyDelete
+	KeySpace
+	KeyDown
+
+	KeyboardKeys
+)
+
+// Keyboard is the Family BASIC keyboard. It sits on the Famicom expansion
+// port, so it takes the place of the second port: writes to $4016 select a
+// half row of the matrix, which is read back on bits 1-4 of $4017.
+type Keyboard struct {
+	keys    [KeyboardKeys]bool
+	row     byte
+	column  byte
+	enabled bool
+}
+
+func NewKeyboard() *Keyboard {
+	return &Keyboard{}
+}
+
+func (k *Keyboard) Save(encoder *gob.Encoder) error {
+	encoder.Encode(k.keys)
+	encoder.Encode(k.row)
+	encoder.Encode(k.column)
+	encoder.Encode(k.enabled)
+	return nil
+}
+
+func (k *Keyboard) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&k.keys)
+	decoder.Decode(&k.row)
+	decoder.Decode(&k.column)
+	decoder.Decode(&k.enabled)
+	return nil
+}
+
+// SetKey presses or releases one of the Key constants.
+func (k *Keyboard) SetKey(key int, pressed bool) {
+	if key >= 0 && key < KeyboardKeys {
+		k.keys[key] = pressed
+	}
+}
+
+// SetKeys sets the state of all keys.
+func (k *Keyboard) SetKeys(keys [KeyboardKeys]bool) {
+	k.keys = keys
+}
+
+func (k *Keyboard) Read() byte {
+	if !k.enabled {
+		return 0
+	}
+	value := byte(0x1E)
+	if k.row < 9 {
+		base := int(k.row)*8 + int(k.column)*4
+		for i := 0; i < 4; i++ {
+			if k.keys[base+i] {
+				value &^= 2 << uint(i)
+			}
+		}
+	}
+	return value
+}
+
+// Write handles the three bits written to $4016: bit 0 resets the matrix to
+// the first row, bit 1 selects the column, moving to the next row when it
+// goes from 1 to 0, and bit 2 enables the keyboard.
+func (k *Keyboard) Write(value byte) {
+	column := value >> 1 & 1
+	k.enabled = value&4 == 4
+	if k.enabled {
+		if column == 0 && k.column == 1 {
+			k.row = (k.row + 1) % 10
+		}
+		if value&1 == 1 {
+			k.row = 0
+		}
+	}
+	k.column = column
+}
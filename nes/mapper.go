@@ -13,6 +13,45 @@ type Mapper interface {
 	Load(decoder *gob.Decoder) error
 }
 
+// PPUAddressWatcher is implemented by mappers that need to see every address
+// the PPU reads from or writes to, not just the CHR accesses that go through
+// Read and Write. Reads are reported after the value has been fetched.
+type PPUAddressWatcher interface {
+	WatchPPUAddress(address uint16)
+}
+
+// CPUStepper is implemented by mappers with hardware that is clocked by the
+// CPU, such as cycle based IRQ counters. StepCPU is called once per CPU cycle.
+type CPUStepper interface {
+	StepCPU()
+}
+
+// ExpansionAudio is implemented by mappers with their own sound hardware.
+// AudioOutput returns the current sample, which is mixed with the APU output.
+type ExpansionAudio interface {
+	AudioOutput() float32
+}
+
+// ExpansionMemory is implemented by mappers with registers in the expansion
+// area at $4020-$5FFF, which is otherwise open bus.
+type ExpansionMemory interface {
+	ReadExpansion(address uint16) byte
+	WriteExpansion(address uint16, value byte)
+}
+
+// NameTableMapper is implemented by mappers that take over nametable accesses
+// at $2000-$3EFF instead of relying on the cartridge mirroring mode.
+type NameTableMapper interface {
+	ReadNameTable(address uint16) byte
+	WriteNameTable(address uint16, value byte)
+}
+
+// prgBanks32K returns the number of 32KB PRG-ROM banks of a cartridge. A
+// 16KB ROM counts as one bank, mirrored at $8000 and $C000.
+func prgBanks32K(cartridge *Cartridge) int {
+	return (len(cartridge.PRG) + 0x7FFF) / 0x8000
+}
+
 func NewMapper(console *Console) (Mapper, error) {
 	cartridge := console.Cartridge
 	switch cartridge.Mapper {
@@ -28,8 +67,34 @@ func NewMapper(console *Console) (Mapper, error) {
 		return NewMapper4(console, cartridge), nil
 	case 7:
 		return NewMapper7(cartridge), nil
+	case 9:
+		return NewMapper9(cartridge), nil
+	case 10:
+		return NewMapper10(cartridge), nil
+	case 11:
+		return NewMapper11(cartridge), nil
+	case 19:
+		return NewMapper19(console, cartridge), nil
+	case 20:
+		return NewMapper20(console, cartridge), nil
+	case 34:
+		return NewMapper34(cartridge), nil
 	case 40:
 		return NewMapper40(console, cartridge), nil
+	case 66:
+		return NewMapper66(cartridge), nil
+	case 69:
+		return NewMapper69(console, cartridge), nil
+	case 71:
+		return NewMapper71(cartridge), nil
+	case 79:
+		return NewMapper79(cartridge), nil
+	case 87:
+		return NewMapper87(cartridge), nil
+	case 140:
+		return NewMapper140(cartridge), nil
+	case 206:
+		return NewMapper206(cartridge), nil
 	case 225:
 		return NewMapper225(cartridge), nil
 	}
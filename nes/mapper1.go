@@ -1,9 +1,6 @@
 package nes
 
-import (
-	"encoding/gob"
-	"log"
-)
+import "encoding/gob"
 
 type Mapper1 struct {
 	*Cartridge
@@ -69,9 +66,8 @@ func (m *Mapper1) Read(address uint16) byte {
 	case address >= 0x6000:
 		return m.SRAM[int(address)-0x6000]
 	default:
-		log.Fatalf("unhandled mapper1 read at address: 0x%04X", address)
+		panic(AddressError{"mapper1", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper1) Write(address uint16, value byte) {
@@ -85,7 +81,7 @@ func (m *Mapper1) Write(address uint16, value byte) {
 	case address >= 0x6000:
 		m.SRAM[int(address)-0x6000] = value
 	default:
-		log.Fatalf("unhandled mapper1 write at address: 0x%04X", address)
+		panic(AddressError{"mapper1", true, address})
 	}
 }
 
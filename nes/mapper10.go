@@ -0,0 +1,146 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/MMC4
+
+type Mapper10 struct {
+	*Cartridge
+	prgBank    byte
+	chrBanks   [4]byte // $FD/$0000, $FE/$0000, $FD/$1000, $FE/$1000
+	latches    [2]byte // $FD or $FE
+	prgOffsets [2]int
+	chrOffsets [2]int
+}
+
+func NewMapper10(cartridge *Cartridge) Mapper {
+	m := Mapper10{Cartridge: cartridge}
+	m.latches[0] = 0xFE
+	m.latches[1] = 0xFE
+	m.updateOffsets()
+	return &m
+}
+
+func (m *Mapper10) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBanks)
+	encoder.Encode(m.latches)
+	encoder.Encode(m.prgOffsets)
+	encoder.Encode(m.chrOffsets)
+	return nil
+}
+
+func (m *Mapper10) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBanks)
+	decoder.Decode(&m.latches)
+	decoder.Decode(&m.prgOffsets)
+	decoder.Decode(&m.chrOffsets)
+	return nil
+}
+
+func (m *Mapper10) Step() {
+}
+
+func (m *Mapper10) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x1000
+		offset := address % 0x1000
+		return m.CHR[m.chrOffsets[bank]+int(offset)]
+	case address >= 0x8000:
+		address = address - 0x8000
+		bank := address / 0x4000
+		offset := address % 0x4000
+		return m.PRG[m.prgOffsets[bank]+int(offset)]
+	case address >= 0x6000:
+		return m.SRAM[int(address)-0x6000]
+	default:
+		panic(AddressError{"mapper10", false, address})
+	}
+}
+
+func (m *Mapper10) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x1000
+		offset := address % 0x1000
+		m.CHR[m.chrOffsets[bank]+int(offset)] = value
+	case address >= 0xF000:
+		switch value & 1 {
+		case 0:
+			m.Cartridge.Mirror = MirrorVertical
+		case 1:
+			m.Cartridge.Mirror = MirrorHorizontal
+		}
+	case address >= 0xB000:
+		m.chrBanks[(address-0xB000)/0x1000] = value & 0x1F
+		m.updateOffsets()
+	case address >= 0xA000:
+		m.prgBank = value & 0x0F
+		m.updateOffsets()
+	case address >= 0x8000:
+	case address >= 0x6000:
+		m.SRAM[int(address)-0x6000] = value
+	default:
+		panic(AddressError{"mapper10", true, address})
+	}
+}
+
+// WatchPPUAddress flips the CHR latches after the PPU fetches tile $FD or
+// $FE. Unlike MMC2, both latches respond to the whole 8-byte tile range.
+func (m *Mapper10) WatchPPUAddress(address uint16) {
+	switch {
+	case address >= 0x0FD8 && address <= 0x0FDF:
+		m.setLatch(0, 0xFD)
+	case address >= 0x0FE8 && address <= 0x0FEF:
+		m.setLatch(0, 0xFE)
+	case address >= 0x1FD8 && address <= 0x1FDF:
+		m.setLatch(1, 0xFD)
+	case address >= 0x1FE8 && address <= 0x1FEF:
+		m.setLatch(1, 0xFE)
+	}
+}
+
+func (m *Mapper10) setLatch(index int, value byte) {
+	if m.latches[index] != value {
+		m.latches[index] = value
+		m.updateOffsets()
+	}
+}
+
+func (m *Mapper10) prgBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.PRG) / 0x4000
+	offset := index * 0x4000
+	if offset < 0 {
+		offset += len(m.PRG)
+	}
+	return offset
+}
+
+func (m *Mapper10) chrBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.CHR) / 0x1000
+	offset := index * 0x1000
+	if offset < 0 {
+		offset += len(m.CHR)
+	}
+	return offset
+}
+
+func (m *Mapper10) updateOffsets() {
+	m.prgOffsets[0] = m.prgBankOffset(int(m.prgBank))
+	m.prgOffsets[1] = m.prgBankOffset(-1)
+	for i := range m.chrOffsets {
+		bank := m.chrBanks[i*2]
+		if m.latches[i] == 0xFE {
+			bank = m.chrBanks[i*2+1]
+		}
+		m.chrOffsets[i] = m.chrBankOffset(int(bank))
+	}
+}
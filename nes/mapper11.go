@@ -0,0 +1,64 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Color_Dreams
+
+type Mapper11 struct {
+	*Cartridge
+	prgBank int
+	chrBank int
+}
+
+func NewMapper11(cartridge *Cartridge) Mapper {
+	return &Mapper11{cartridge, 0, 0}
+}
+
+func (m *Mapper11) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBank)
+	return nil
+}
+
+func (m *Mapper11) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBank)
+	return nil
+}
+
+func (m *Mapper11) Step() {
+}
+
+func (m *Mapper11) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		return m.CHR[index]
+	case address >= 0x8000:
+		index := (m.prgBank*0x8000 + int(address-0x8000)) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		return m.SRAM[index]
+	default:
+		panic(AddressError{"mapper11", false, address})
+	}
+}
+
+func (m *Mapper11) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		m.CHR[index] = value
+	case address >= 0x8000:
+		// bus conflict: the ROM drives the data bus at the same time
+		value &= m.Read(address)
+		m.prgBank = int(value&0x03) % prgBanks32K(m.Cartridge)
+		m.chrBank = int(value>>4) % (len(m.CHR) / 0x2000)
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		m.SRAM[index] = value
+	default:
+		panic(AddressError{"mapper11", true, address})
+	}
+}
@@ -0,0 +1,60 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_140
+
+type Mapper140 struct {
+	*Cartridge
+	prgBank int
+	chrBank int
+}
+
+func NewMapper140(cartridge *Cartridge) Mapper {
+	return &Mapper140{cartridge, 0, 0}
+}
+
+func (m *Mapper140) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBank)
+	return nil
+}
+
+func (m *Mapper140) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBank)
+	return nil
+}
+
+func (m *Mapper140) Step() {
+}
+
+func (m *Mapper140) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		return m.CHR[index]
+	case address >= 0x8000:
+		index := (m.prgBank*0x8000 + int(address-0x8000)) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		// the bank register is write only and there is no PRG RAM
+		return 0
+	default:
+		panic(AddressError{"mapper140", false, address})
+	}
+}
+
+func (m *Mapper140) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		m.CHR[index] = value
+	case address >= 0x8000:
+	case address >= 0x6000:
+		m.prgBank = int(value>>4&0x03) % prgBanks32K(m.Cartridge)
+		m.chrBank = int(value&0x0F) % (len(m.CHR) / 0x2000)
+	default:
+		panic(AddressError{"mapper140", true, address})
+	}
+}
@@ -0,0 +1,311 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_019
+// https://wiki.nesdev.com/w/index.php/Namco_163_audio
+
+// The 128 bytes of internal RAM are kept after the 8KB of PRG RAM in the
+// cartridge SRAM, so that battery backed titles persist them along with it.
+const namco163RAM = 0x2000
+
+type Mapper19 struct {
+	*Cartridge
+	console       *Console
+	prgBanks      [3]byte
+	chrBanks      [8]byte
+	nameTables    [4]byte
+	chrRAMDisable [2]bool // $0000-$0FFF, $1000-$1FFF
+	writeProtect  byte
+	ramAddress    byte
+	autoIncrement bool
+	irqCounter    uint16
+	irqEnable     bool
+	soundDisable  bool
+	audio         Namco163Audio
+}
+
+func NewMapper19(console *Console, cartridge *Cartridge) Mapper {
+	if len(cartridge.SRAM) < namco163RAM+0x80 {
+		sram := make([]byte, namco163RAM+0x80)
+		copy(sram, cartridge.SRAM)
+		cartridge.SRAM = sram
+	}
+	m := Mapper19{Cartridge: cartridge, console: console}
+	return &m
+}
+
+func (m *Mapper19) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBanks)
+	encoder.Encode(m.chrBanks)
+	encoder.Encode(m.nameTables)
+	encoder.Encode(m.chrRAMDisable)
+	encoder.Encode(m.writeProtect)
+	encoder.Encode(m.ramAddress)
+	encoder.Encode(m.autoIncrement)
+	encoder.Encode(m.irqCounter)
+	encoder.Encode(m.irqEnable)
+	encoder.Encode(m.soundDisable)
+	m.audio.Save(encoder)
+	encoder.Encode(m.internalRAM())
+	return nil
+}
+
+func (m *Mapper19) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBanks)
+	decoder.Decode(&m.chrBanks)
+	decoder.Decode(&m.nameTables)
+	decoder.Decode(&m.chrRAMDisable)
+	decoder.Decode(&m.writeProtect)
+	decoder.Decode(&m.ramAddress)
+	decoder.Decode(&m.autoIncrement)
+	decoder.Decode(&m.irqCounter)
+	decoder.Decode(&m.irqEnable)
+	decoder.Decode(&m.soundDisable)
+	m.audio.Load(decoder)
+	var ram []byte
+	decoder.Decode(&ram)
+	copy(m.internalRAM(), ram)
+	return nil
+}
+
+func (m *Mapper19) internalRAM() []byte {
+	return m.SRAM[namco163RAM : namco163RAM+0x80]
+}
+
+func (m *Mapper19) Step() {
+}
+
+// StepCPU clocks the 15-bit IRQ counter, which counts up to $7FFF and stops
+// there, and the wavetable synth, which updates one channel every 15 cycles.
+func (m *Mapper19) StepCPU() {
+	if m.irqEnable && m.irqCounter < 0x7FFF {
+		m.irqCounter++
+		if m.irqCounter == 0x7FFF {
+			m.console.CPU.triggerIRQ()
+		}
+	}
+	if !m.soundDisable {
+		m.audio.step(m.internalRAM())
+	}
+}
+
+func (m *Mapper19) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return m.readCHR(int(address/0x0400), address%0x0400, m.chrRAMDisable[address/0x1000])
+	case address >= 0xE000:
+		return m.PRG[m.prgBankOffset(-1)+int(address-0xE000)]
+	case address >= 0x8000:
+		bank := (address - 0x8000) / 0x2000
+		offset := address % 0x2000
+		return m.PRG[m.prgBankOffset(int(m.prgBanks[bank]))+int(offset)]
+	case address >= 0x6000:
+		return m.SRAM[int(address)-0x6000]
+	default:
+		panic(AddressError{"mapper19", false, address})
+	}
+}
+
+func (m *Mapper19) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		m.writeCHR(int(address/0x0400), address%0x0400, m.chrRAMDisable[address/0x1000], value)
+	case address >= 0xF800:
+		m.writeProtect = value
+		m.ramAddress = value & 0x7F
+		m.autoIncrement = value&0x80 == 0x80
+	case address >= 0xF000:
+		m.prgBanks[2] = value & 0x3F
+	case address >= 0xE800:
+		m.prgBanks[1] = value & 0x3F
+		m.chrRAMDisable[0] = value&0x40 == 0x40
+		m.chrRAMDisable[1] = value&0x80 == 0x80
+	case address >= 0xE000:
+		m.prgBanks[0] = value & 0x3F
+		m.soundDisable = value&0x40 == 0x40
+	case address >= 0xC000:
+		m.nameTables[(address-0xC000)/0x0800] = value
+	case address >= 0x8000:
+		m.chrBanks[(address-0x8000)/0x0800] = value
+	case address >= 0x6000:
+		// bits 4-7 of $F800 must be 0100 to enable writes, and bits 0-3
+		// each protect one 2KB window
+		window := (address - 0x6000) / 0x0800
+		if m.writeProtect&0xF0 == 0x40 && m.writeProtect&(1<<window) == 0 {
+			m.SRAM[int(address)-0x6000] = value
+		}
+	default:
+		panic(AddressError{"mapper19", true, address})
+	}
+}
+
+func (m *Mapper19) ReadExpansion(address uint16) byte {
+	switch {
+	case address >= 0x5800:
+		value := byte(m.irqCounter >> 8)
+		if m.irqEnable {
+			value |= 0x80
+		}
+		return value
+	case address >= 0x5000:
+		return byte(m.irqCounter)
+	case address >= 0x4800:
+		ram := m.internalRAM()
+		value := ram[m.ramAddress]
+		m.stepRAMAddress()
+		return value
+	}
+	return 0
+}
+
+func (m *Mapper19) WriteExpansion(address uint16, value byte) {
+	switch {
+	case address >= 0x5800:
+		m.irqCounter = (m.irqCounter & 0x00FF) | uint16(value&0x7F)<<8
+		m.irqEnable = value&0x80 == 0x80
+	case address >= 0x5000:
+		m.irqCounter = (m.irqCounter & 0x7F00) | uint16(value)
+	case address >= 0x4800:
+		ram := m.internalRAM()
+		ram[m.ramAddress] = value
+		m.stepRAMAddress()
+	}
+}
+
+func (m *Mapper19) stepRAMAddress() {
+	if m.autoIncrement {
+		m.ramAddress = (m.ramAddress + 1) & 0x7F
+	}
+}
+
+// ReadNameTable and WriteNameTable map each of the four nametables to either
+// a page of CIRAM ($E0-$FF) or a 1KB page of CHR-ROM.
+func (m *Mapper19) ReadNameTable(address uint16) byte {
+	address = (address - 0x2000) % 0x1000
+	return m.readCHR(int(8+address/0x0400), address%0x0400, false)
+}
+
+func (m *Mapper19) WriteNameTable(address uint16, value byte) {
+	address = (address - 0x2000) % 0x1000
+	m.writeCHR(int(8+address/0x0400), address%0x0400, false, value)
+}
+
+// readCHR reads from one of the twelve 1KB PPU windows: eight pattern table
+// banks followed by four nametables. Bank values of $E0 and above select
+// CIRAM unless the window has CIRAM disabled.
+func (m *Mapper19) readCHR(window int, offset uint16, romOnly bool) byte {
+	bank := m.bank(window)
+	if bank >= 0xE0 && !romOnly {
+		return m.console.PPU.nameTableData[int(bank&1)*0x0400+int(offset)]
+	}
+	return m.CHR[m.chrBankOffset(int(bank))+int(offset)]
+}
+
+func (m *Mapper19) writeCHR(window int, offset uint16, romOnly bool, value byte) {
+	bank := m.bank(window)
+	if bank >= 0xE0 && !romOnly {
+		m.console.PPU.nameTableData[int(bank&1)*0x0400+int(offset)] = value
+	}
+}
+
+func (m *Mapper19) bank(window int) byte {
+	if window < 8 {
+		return m.chrBanks[window]
+	}
+	return m.nameTables[window-8]
+}
+
+func (m *Mapper19) prgBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.PRG) / 0x2000
+	offset := index * 0x2000
+	if offset < 0 {
+		offset += len(m.PRG)
+	}
+	return offset
+}
+
+func (m *Mapper19) chrBankOffset(index int) int {
+	index %= len(m.CHR) / 0x0400
+	return index * 0x0400
+}
+
+func (m *Mapper19) AudioOutput() float32 {
+	if m.soundDisable {
+		return 0
+	}
+	return m.audio.output(m.internalRAM())
+}
+
+// Namco 163 audio
+
+// Namco163Audio is the wavetable synth of the Namco 163. The waveforms and
+// the channel registers share the chip's 128 bytes of internal RAM, which is
+// passed in by the owner so that it can live wherever it needs to be saved.
+type Namco163Audio struct {
+	channel int
+	divider int
+	outputs [8]int
+}
+
+func (a *Namco163Audio) Save(encoder *gob.Encoder) error {
+	encoder.Encode(a.channel)
+	encoder.Encode(a.divider)
+	encoder.Encode(a.outputs)
+	return nil
+}
+
+func (a *Namco163Audio) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&a.channel)
+	decoder.Decode(&a.divider)
+	decoder.Decode(&a.outputs)
+	return nil
+}
+
+// The channel registers occupy the top of the internal RAM, eight bytes per
+// channel, with channel 7 at $78-$7F. Bits 4-6 of $7F hold the number of
+// enabled channels minus one, counting down from channel 7.
+func namco163Channels(ram []byte) int {
+	return int(ram[0x7F]>>4&7) + 1
+}
+
+// step is called once per CPU cycle and updates one channel every 15 cycles.
+func (a *Namco163Audio) step(ram []byte) {
+	a.divider++
+	if a.divider < 15 {
+		return
+	}
+	a.divider = 0
+	count := namco163Channels(ram)
+	a.channel++
+	if a.channel >= count {
+		a.channel = 0
+	}
+	channel := 7 - a.channel
+	base := 0x40 + channel*8
+	frequency := uint32(ram[base]) | uint32(ram[base+2])<<8 | uint32(ram[base+4]&3)<<16
+	phase := uint32(ram[base+1]) | uint32(ram[base+3])<<8 | uint32(ram[base+5])<<16
+	length := 256 - uint32(ram[base+4]&0xFC)
+	phase = (phase + frequency) % (length << 16)
+	ram[base+1] = byte(phase)
+	ram[base+3] = byte(phase >> 8)
+	ram[base+5] = byte(phase >> 16)
+	sampleAddress := (phase>>16 + uint32(ram[base+6])) & 0xFF
+	sample := int(ram[sampleAddress>>1]>>(4*(sampleAddress&1))) & 0x0F
+	volume := int(ram[base+7] & 0x0F)
+	a.outputs[channel] = (sample - 8) * volume
+}
+
+// output averages the enabled channels, as the real chip time multiplexes
+// them through a single DAC.
+func (a *Namco163Audio) output(ram []byte) float32 {
+	count := namco163Channels(ram)
+	sum := 0
+	for i := 8 - count; i < 8; i++ {
+		sum += a.outputs[i]
+	}
+	return float32(sum) / float32(count) * 0.002
+}
@@ -1,9 +1,6 @@
 package nes
 
-import (
-	"encoding/gob"
-	"log"
-)
+import "encoding/gob"
 
 type Mapper2 struct {
 	*Cartridge
@@ -50,9 +47,8 @@ func (m *Mapper2) Read(address uint16) byte {
 		index := int(address) - 0x6000
 		return m.SRAM[index]
 	default:
-		log.Fatalf("unhandled mapper2 read at address: 0x%04X", address)
+		panic(AddressError{"mapper2", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper2) Write(address uint16, value byte) {
@@ -65,6 +61,6 @@ func (m *Mapper2) Write(address uint16, value byte) {
 		index := int(address) - 0x6000
 		m.SRAM[index] = value
 	default:
-		log.Fatalf("unhandled mapper2 write at address: 0x%04X", address)
+		panic(AddressError{"mapper2", true, address})
 	}
 }
@@ -0,0 +1,408 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Family_Computer_Disk_System
+
+const (
+	fdsNoDisk = -1
+
+	// the BIOS only notices a disk change if the drive reports no disk for
+	// a while, so inserting a disk is delayed by about a second
+	fdsInsertDelay = CPUFrequency
+
+	// cycles between the motor starting and the head reaching the first gap,
+	// and between two bytes passing under the head
+	fdsSeekDelay = 50000
+	fdsByteDelay = 150
+)
+
+// Mapper20 is the Famicom Disk System RAM adapter. It provides 32KB of
+// PRG-RAM at $6000-$DFFF, 8KB of CHR-RAM, the BIOS at $E000-$FFFF, a timer
+// IRQ, the disk drive interface and an extra sound channel.
+type Mapper20 struct {
+	*Cartridge
+	console *Console
+	ram     []byte
+	sides   [][]byte // disk sides as seen by the drive head
+	disks   [][]byte // the sides as loaded, which states are saved against
+
+	// disk drive
+	side          int
+	nextSide      int
+	insertDelay   int
+	position      int
+	delay         int
+	motorOn       bool
+	resetTransfer bool
+	readMode      bool
+	crcControl    bool
+	diskReady     bool
+	diskIRQEnable bool
+	endOfHead     bool
+	scanning      bool
+	gapEnded      bool
+	readData      byte
+	writeData     byte
+	transferDone  bool
+	diskIRQ       bool
+
+	// I/O enable and timer IRQ
+	diskRegisters  bool
+	soundRegisters bool
+	irqReload      uint16
+	irqCounter     uint16
+	irqEnable      bool
+	irqRepeat      bool
+	timerIRQ       bool
+
+	audio FDSAudio
+}
+
+func NewMapper20(console *Console, cartridge *Cartridge) Mapper {
+	m := Mapper20{Cartridge: cartridge, console: console}
+	m.ram = make([]byte, 0x8000)
+	for _, side := range cartridge.Disk {
+		raw := fdsRawSide(side)
+		m.disks = append(m.disks, raw)
+		m.sides = append(m.sides, append([]byte(nil), raw...))
+	}
+	m.side = fdsNoDisk
+	m.nextSide = fdsNoDisk
+	if len(m.sides) > 0 {
+		m.side = 0
+	}
+	m.diskRegisters = true
+	m.soundRegisters = true
+	m.audio.reset()
+	return &m
+}
+
+func (m *Mapper20) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.ram)
+	diffs := make([][]byte, len(m.sides))
+	for i, side := range m.sides {
+		diffs[i] = fdsDiff(m.disks[i], side)
+	}
+	encoder.Encode(diffs)
+	encoder.Encode(m.side)
+	encoder.Encode(m.nextSide)
+	encoder.Encode(m.insertDelay)
+	encoder.Encode(m.position)
+	encoder.Encode(m.delay)
+	encoder.Encode(m.motorOn)
+	encoder.Encode(m.resetTransfer)
+	encoder.Encode(m.readMode)
+	encoder.Encode(m.crcControl)
+	encoder.Encode(m.diskReady)
+	encoder.Encode(m.diskIRQEnable)
+	encoder.Encode(m.endOfHead)
+	encoder.Encode(m.scanning)
+	encoder.Encode(m.gapEnded)
+	encoder.Encode(m.readData)
+	encoder.Encode(m.writeData)
+	encoder.Encode(m.transferDone)
+	encoder.Encode(m.diskIRQ)
+	encoder.Encode(m.diskRegisters)
+	encoder.Encode(m.soundRegisters)
+	encoder.Encode(m.irqReload)
+	encoder.Encode(m.irqCounter)
+	encoder.Encode(m.irqEnable)
+	encoder.Encode(m.irqRepeat)
+	encoder.Encode(m.timerIRQ)
+	m.audio.Save(encoder)
+	return nil
+}
+
+func (m *Mapper20) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.ram)
+	var diffs [][]byte
+	if err := decoder.Decode(&diffs); err == nil {
+		for i := range m.sides {
+			var diff []byte
+			if i < len(diffs) {
+				diff = diffs[i]
+			}
+			m.sides[i] = fdsPatch(m.disks[i], diff)
+		}
+	}
+	decoder.Decode(&m.side)
+	decoder.Decode(&m.nextSide)
+	decoder.Decode(&m.insertDelay)
+	decoder.Decode(&m.position)
+	decoder.Decode(&m.delay)
+	decoder.Decode(&m.motorOn)
+	decoder.Decode(&m.resetTransfer)
+	decoder.Decode(&m.readMode)
+	decoder.Decode(&m.crcControl)
+	decoder.Decode(&m.diskReady)
+	decoder.Decode(&m.diskIRQEnable)
+	decoder.Decode(&m.endOfHead)
+	decoder.Decode(&m.scanning)
+	decoder.Decode(&m.gapEnded)
+	decoder.Decode(&m.readData)
+	decoder.Decode(&m.writeData)
+	decoder.Decode(&m.transferDone)
+	decoder.Decode(&m.diskIRQ)
+	decoder.Decode(&m.diskRegisters)
+	decoder.Decode(&m.soundRegisters)
+	decoder.Decode(&m.irqReload)
+	decoder.Decode(&m.irqCounter)
+	decoder.Decode(&m.irqEnable)
+	decoder.Decode(&m.irqRepeat)
+	decoder.Decode(&m.timerIRQ)
+	m.audio.Load(decoder)
+	return nil
+}
+
+func (m *Mapper20) Step() {
+}
+
+func (m *Mapper20) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return m.CHR[address]
+	case address >= 0xE000:
+		return m.PRG[address-0xE000]
+	case address >= 0x6000:
+		return m.ram[address-0x6000]
+	default:
+		panic(AddressError{"mapper20", false, address})
+	}
+}
+
+func (m *Mapper20) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		m.CHR[address] = value
+	case address >= 0xE000:
+	case address >= 0x6000:
+		m.ram[address-0x6000] = value
+	default:
+		panic(AddressError{"mapper20", true, address})
+	}
+}
+
+func (m *Mapper20) ReadExpansion(address uint16) byte {
+	switch {
+	case address == 0x4030:
+		var value byte
+		if m.timerIRQ {
+			value |= 0x01
+		}
+		if m.transferDone {
+			value |= 0x02
+		}
+		if m.endOfHead {
+			value |= 0x40
+		}
+		m.transferDone = false
+		m.timerIRQ = false
+		m.diskIRQ = false
+		return value
+	case address == 0x4031:
+		m.transferDone = false
+		m.diskIRQ = false
+		return m.readData
+	case address == 0x4032:
+		value := byte(0x40)
+		if m.side == fdsNoDisk {
+			// not inserted, not ready and write protected
+			value |= 0x07
+		} else if !m.scanning {
+			value |= 0x02
+		}
+		return value
+	case address == 0x4033:
+		// battery good
+		return 0x80
+	case address >= 0x4040 && address < 0x4098:
+		return m.audio.readRegister(address)
+	}
+	return 0
+}
+
+func (m *Mapper20) WriteExpansion(address uint16, value byte) {
+	if address >= 0x4040 && address < 0x4098 {
+		if m.soundRegisters {
+			m.audio.writeRegister(address, value)
+		}
+		return
+	}
+	if !m.diskRegisters && address != 0x4023 {
+		return
+	}
+	switch address {
+	case 0x4020:
+		m.irqReload = (m.irqReload & 0xFF00) | uint16(value)
+	case 0x4021:
+		m.irqReload = (m.irqReload & 0x00FF) | uint16(value)<<8
+	case 0x4022:
+		m.irqRepeat = value&0x01 == 0x01
+		m.irqEnable = value&0x02 == 0x02
+		if m.irqEnable {
+			m.irqCounter = m.irqReload
+		} else {
+			m.timerIRQ = false
+		}
+	case 0x4023:
+		m.diskRegisters = value&0x01 == 0x01
+		m.soundRegisters = value&0x02 == 0x02
+		if !m.diskRegisters {
+			m.irqEnable = false
+			m.timerIRQ = false
+			m.diskIRQ = false
+		}
+	case 0x4024:
+		m.writeData = value
+		m.transferDone = false
+		m.diskIRQ = false
+	case 0x4025:
+		m.motorOn = value&0x01 == 0x01
+		m.resetTransfer = value&0x02 == 0x02
+		m.readMode = value&0x04 == 0x04
+		switch value & 0x08 {
+		case 0x00:
+			m.Cartridge.Mirror = MirrorVertical
+		case 0x08:
+			m.Cartridge.Mirror = MirrorHorizontal
+		}
+		m.crcControl = value&0x10 == 0x10
+		m.diskReady = value&0x40 == 0x40
+		m.diskIRQEnable = value&0x80 == 0x80
+		m.diskIRQ = false
+	}
+}
+
+// StepCPU clocks the timer IRQ, the sound channel and the disk drive. The
+// IRQ line stays asserted until the game acknowledges it, so it is raised
+// again on every cycle while a flag is pending.
+func (m *Mapper20) StepCPU() {
+	if m.irqEnable {
+		if m.irqCounter == 0 {
+			m.timerIRQ = true
+			m.irqCounter = m.irqReload
+			if !m.irqRepeat {
+				m.irqEnable = false
+			}
+		} else {
+			m.irqCounter--
+		}
+	}
+	m.audio.step()
+	m.stepDisk()
+	if (m.timerIRQ || m.diskIRQ) && m.console.CPU.interrupt == interruptNone {
+		m.console.CPU.triggerIRQ()
+	}
+}
+
+func (m *Mapper20) stepDisk() {
+	if m.insertDelay > 0 {
+		m.insertDelay--
+		if m.insertDelay == 0 {
+			m.side = m.nextSide
+			m.nextSide = fdsNoDisk
+		}
+	}
+	if m.side == fdsNoDisk || !m.motorOn {
+		m.endOfHead = true
+		m.scanning = false
+		return
+	}
+	if m.resetTransfer && !m.scanning {
+		return
+	}
+	if m.endOfHead {
+		// the head returns to the start of the disk
+		m.delay = fdsSeekDelay
+		m.endOfHead = false
+		m.position = 0
+		m.gapEnded = false
+		return
+	}
+	if m.delay > 0 {
+		m.delay--
+		return
+	}
+	m.scanning = true
+	side := m.sides[m.side]
+	irq := m.diskIRQEnable
+	if m.readMode {
+		data := side[m.position]
+		if !m.diskReady {
+			m.gapEnded = false
+		} else if data != 0 && !m.gapEnded {
+			// the $80 start mark ends the gap without an IRQ
+			m.gapEnded = true
+			irq = false
+		}
+		if m.gapEnded {
+			m.transferDone = true
+			m.readData = data
+			if irq {
+				m.diskIRQ = true
+			}
+		}
+	} else {
+		var data byte
+		if !m.crcControl {
+			m.transferDone = true
+			data = m.writeData
+			if irq {
+				m.diskIRQ = true
+			}
+		}
+		if !m.diskReady {
+			data = 0
+		}
+		side[m.position] = data
+		m.gapEnded = false
+	}
+	m.position++
+	if m.position >= len(side) {
+		m.motorOn = false
+	} else {
+		m.delay = fdsByteDelay
+	}
+}
+
+func (m *Mapper20) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+// DiskSides returns the number of disk sides in the image.
+func (m *Mapper20) DiskSides() int {
+	return len(m.sides)
+}
+
+// DiskSide returns the side in the drive, or -1 if there is no disk.
+func (m *Mapper20) DiskSide() int {
+	if m.insertDelay > 0 {
+		return m.nextSide
+	}
+	return m.side
+}
+
+// EjectDisk removes the disk from the drive.
+func (m *Mapper20) EjectDisk() {
+	m.side = fdsNoDisk
+	m.nextSide = fdsNoDisk
+	m.insertDelay = 0
+}
+
+// InsertDisk ejects the current disk and inserts the given side once the
+// BIOS has had time to notice the drive is empty.
+func (m *Mapper20) InsertDisk(side int) {
+	m.side = fdsNoDisk
+	m.nextSide = side
+	m.insertDelay = fdsInsertDelay
+}
+
+// keepDisks moves the disks and the drive's side from another adapter, which
+// is being replaced when the console is turned off and on.
+func (m *Mapper20) keepDisks(other *Mapper20) {
+	m.sides = other.sides
+	m.side = other.side
+	m.nextSide = other.nextSide
+	m.insertDelay = other.insertDelay
+}
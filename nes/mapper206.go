@@ -0,0 +1,119 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_206
+
+// Mapper206 is the Namco 108, the predecessor of the MMC3. It has the same
+// bank registers but no IRQ counter, no PRG or CHR mode bits and hardwired
+// mirroring.
+type Mapper206 struct {
+	*Cartridge
+	register   byte
+	registers  [8]byte
+	prgOffsets [4]int
+	chrOffsets [8]int
+}
+
+func NewMapper206(cartridge *Cartridge) Mapper {
+	m := Mapper206{Cartridge: cartridge}
+	m.updateOffsets()
+	return &m
+}
+
+func (m *Mapper206) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.register)
+	encoder.Encode(m.registers)
+	encoder.Encode(m.prgOffsets)
+	encoder.Encode(m.chrOffsets)
+	return nil
+}
+
+func (m *Mapper206) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.register)
+	decoder.Decode(&m.registers)
+	decoder.Decode(&m.prgOffsets)
+	decoder.Decode(&m.chrOffsets)
+	return nil
+}
+
+func (m *Mapper206) Step() {
+}
+
+func (m *Mapper206) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x0400
+		offset := address % 0x0400
+		return m.CHR[m.chrOffsets[bank]+int(offset)]
+	case address >= 0x8000:
+		address = address - 0x8000
+		bank := address / 0x2000
+		offset := address % 0x2000
+		return m.PRG[m.prgOffsets[bank]+int(offset)]
+	case address >= 0x6000:
+		return m.SRAM[int(address)-0x6000]
+	default:
+		panic(AddressError{"mapper206", false, address})
+	}
+}
+
+func (m *Mapper206) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x0400
+		offset := address % 0x0400
+		m.CHR[m.chrOffsets[bank]+int(offset)] = value
+	case address >= 0xA000:
+	case address >= 0x8000:
+		if address%2 == 0 {
+			m.register = value & 7
+		} else {
+			m.registers[m.register] = value
+			m.updateOffsets()
+		}
+	case address >= 0x6000:
+		m.SRAM[int(address)-0x6000] = value
+	default:
+		panic(AddressError{"mapper206", true, address})
+	}
+}
+
+func (m *Mapper206) prgBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.PRG) / 0x2000
+	offset := index * 0x2000
+	if offset < 0 {
+		offset += len(m.PRG)
+	}
+	return offset
+}
+
+func (m *Mapper206) chrBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.CHR) / 0x0400
+	offset := index * 0x0400
+	if offset < 0 {
+		offset += len(m.CHR)
+	}
+	return offset
+}
+
+func (m *Mapper206) updateOffsets() {
+	m.prgOffsets[0] = m.prgBankOffset(int(m.registers[6] & 0x0F))
+	m.prgOffsets[1] = m.prgBankOffset(int(m.registers[7] & 0x0F))
+	m.prgOffsets[2] = m.prgBankOffset(-2)
+	m.prgOffsets[3] = m.prgBankOffset(-1)
+	m.chrOffsets[0] = m.chrBankOffset(int(m.registers[0] & 0x3E))
+	m.chrOffsets[1] = m.chrBankOffset(int(m.registers[0]&0x3E | 0x01))
+	m.chrOffsets[2] = m.chrBankOffset(int(m.registers[1] & 0x3E))
+	m.chrOffsets[3] = m.chrBankOffset(int(m.registers[1]&0x3E | 0x01))
+	m.chrOffsets[4] = m.chrBankOffset(int(m.registers[2] & 0x3F))
+	m.chrOffsets[5] = m.chrBankOffset(int(m.registers[3] & 0x3F))
+	m.chrOffsets[6] = m.chrBankOffset(int(m.registers[4] & 0x3F))
+	m.chrOffsets[7] = m.chrBankOffset(int(m.registers[5] & 0x3F))
+}
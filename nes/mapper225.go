@@ -1,9 +1,6 @@
 package nes
 
-import (
-	"encoding/gob"
-	"log"
-)
+import "encoding/gob"
 
 // https://github.com/asfdfdfd/fceux/blob/master/src/boards/225.cpp
 // https://wiki.nesdev.com/w/index.php/INES_Mapper_225
@@ -52,9 +49,8 @@ func (m *Mapper225) Read(address uint16) byte {
 		index := int(address) - 0x6000
 		return m.SRAM[index]
 	default:
-		log.Fatalf("unhandled Mapper225 read at address: 0x%04X", address)
+		panic(AddressError{"mapper225", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper225) Write(address uint16, value byte) {
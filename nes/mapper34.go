@@ -0,0 +1,98 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_034
+
+// Mapper 34 covers two unrelated boards. BNROM switches 32KB of PRG with a
+// write anywhere in $8000-$FFFF and has CHR-RAM. NINA-001 has registers at
+// $7FFD-$7FFF that switch 32KB of PRG and two 4KB banks of CHR-ROM.
+
+type Mapper34 struct {
+	*Cartridge
+	nina     bool
+	prgBank  int
+	chrBanks [2]int
+}
+
+func NewMapper34(cartridge *Cartridge) Mapper {
+	var nina bool
+	switch cartridge.SubMapper {
+	case 1:
+		nina = true
+	case 2:
+		nina = false
+	default:
+		nina = len(cartridge.CHR) > 0x2000
+	}
+	m := Mapper34{Cartridge: cartridge, nina: nina}
+	m.chrBanks[1] = 1
+	return &m
+}
+
+func (m *Mapper34) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBanks)
+	return nil
+}
+
+func (m *Mapper34) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBanks)
+	return nil
+}
+
+func (m *Mapper34) Step() {
+}
+
+func (m *Mapper34) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return m.CHR[m.chrIndex(address)]
+	case address >= 0x8000:
+		index := (m.prgBank*0x8000 + int(address-0x8000)) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		return m.SRAM[index]
+	default:
+		panic(AddressError{"mapper34", false, address})
+	}
+}
+
+func (m *Mapper34) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		m.CHR[m.chrIndex(address)] = value
+	case address >= 0x8000:
+		if !m.nina {
+			// bus conflict: the ROM drives the data bus at the same time
+			value &= m.Read(address)
+			m.prgBank = int(value) % prgBanks32K(m.Cartridge)
+		}
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		m.SRAM[index] = value
+		if m.nina {
+			switch address {
+			case 0x7FFD:
+				m.prgBank = int(value&1) % prgBanks32K(m.Cartridge)
+			case 0x7FFE:
+				m.chrBanks[0] = int(value&0x0F) % (len(m.CHR) / 0x1000)
+			case 0x7FFF:
+				m.chrBanks[1] = int(value&0x0F) % (len(m.CHR) / 0x1000)
+			}
+		}
+	default:
+		panic(AddressError{"mapper34", true, address})
+	}
+}
+
+func (m *Mapper34) chrIndex(address uint16) int {
+	if !m.nina {
+		return int(address)
+	}
+	bank := address / 0x1000
+	offset := address % 0x1000
+	return m.chrBanks[bank]*0x1000 + int(offset)
+}
@@ -1,26 +1,34 @@
 package nes
 
-import (
-	"encoding/gob"
-	"log"
-)
+import "encoding/gob"
+
+// a12Filter is the number of PPU cycles A12 must stay low before a rising
+// edge clocks the IRQ counter. The MMC3 filters A12 with M2 and only counts
+// a rise after A12 has been low for three falling edges of M2.
+const a12Filter = 10
 
 type Mapper4 struct {
 	*Cartridge
-	console    *Console
-	register   byte
-	registers  [8]byte
-	prgMode    byte
-	chrMode    byte
-	prgOffsets [4]int
-	chrOffsets [8]int
-	reload     byte
-	counter    byte
-	irqEnable  bool
+	console     *Console
+	register    byte
+	registers   [8]byte
+	prgMode     byte
+	chrMode     byte
+	prgOffsets  [4]int
+	chrOffsets  [8]int
+	reload      byte
+	counter     byte
+	irqReload   bool
+	irqEnable   bool
+	revisionA   bool   // MMC3A: no IRQ when reloading a counter of 0
+	cycle       uint64 // PPU cycles since power on
+	a12         bool   // last seen state of PPU A12
+	a12LowCycle uint64 // cycle on which A12 last went low
 }
 
 func NewMapper4(console *Console, cartridge *Cartridge) Mapper {
 	m := Mapper4{Cartridge: cartridge, console: console}
+	m.revisionA = cartridge.SubMapper == 4
 	m.prgOffsets[0] = m.prgBankOffset(0)
 	m.prgOffsets[1] = m.prgBankOffset(1)
 	m.prgOffsets[2] = m.prgBankOffset(-2)
@@ -37,7 +45,11 @@ func (m *Mapper4) Save(encoder *gob.Encoder) error {
 	encoder.Encode(m.chrOffsets)
 	encoder.Encode(m.reload)
 	encoder.Encode(m.counter)
+	encoder.Encode(m.irqReload)
 	encoder.Encode(m.irqEnable)
+	encoder.Encode(m.cycle)
+	encoder.Encode(m.a12)
+	encoder.Encode(m.a12LowCycle)
 	return nil
 }
 
@@ -50,33 +62,49 @@ func (m *Mapper4) Load(decoder *gob.Decoder) error {
 	decoder.Decode(&m.chrOffsets)
 	decoder.Decode(&m.reload)
 	decoder.Decode(&m.counter)
+	decoder.Decode(&m.irqReload)
 	decoder.Decode(&m.irqEnable)
+	decoder.Decode(&m.cycle)
+	decoder.Decode(&m.a12)
+	decoder.Decode(&m.a12LowCycle)
 	return nil
 }
 
 func (m *Mapper4) Step() {
-	ppu := m.console.PPU
-	if ppu.Cycle != 280 { // TODO: this *should* be 260
-		return
-	}
-	if ppu.ScanLine > 239 && ppu.ScanLine < 261 {
-		return
+	m.cycle++
+}
+
+// WatchPPUAddress clocks the scanline counter on filtered rising edges of
+// PPU A12. During rendering this happens once per line, when the PPU moves
+// from fetching one pattern table to the other.
+func (m *Mapper4) WatchPPUAddress(address uint16) {
+	a12 := address&0x1000 != 0
+	if a12 && !m.a12 && m.cycle-m.a12LowCycle >= a12Filter {
+		m.HandleScanLine()
 	}
-	if ppu.flagShowBackground == 0 && ppu.flagShowSprites == 0 {
-		return
+	if !a12 && m.a12 {
+		m.a12LowCycle = m.cycle
 	}
-	m.HandleScanLine()
+	m.a12 = a12
 }
 
 func (m *Mapper4) HandleScanLine() {
-	if m.counter == 0 {
+	counter := m.counter
+	if m.counter == 0 || m.irqReload {
 		m.counter = m.reload
 	} else {
 		m.counter--
+	}
+	if m.revisionA {
+		if (counter > 0 || m.irqReload) && m.counter == 0 && m.irqEnable {
+			m.console.CPU.triggerIRQ()
+		}
+	} else {
 		if m.counter == 0 && m.irqEnable {
 			m.console.CPU.triggerIRQ()
 		}
 	}
+	m.irqReload = false
 }
 
 func (m *Mapper4) Read(address uint16) byte {
@@ -93,9 +121,8 @@ func (m *Mapper4) Read(address uint16) byte {
 	case address >= 0x6000:
 		return m.SRAM[int(address)-0x6000]
 	default:
-		log.Fatalf("unhandled mapper4 read at address: 0x%04X", address)
+		panic(AddressError{"mapper4", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper4) Write(address uint16, value byte) {
@@ -109,7 +136,7 @@ func (m *Mapper4) Write(address uint16, value byte) {
 	case address >= 0x6000:
 		m.SRAM[int(address)-0x6000] = value
 	default:
-		log.Fatalf("unhandled mapper4 write at address: 0x%04X", address)
+		panic(AddressError{"mapper4", true, address})
 	}
 }
 
@@ -164,6 +191,7 @@ func (m *Mapper4) writeIRQLatch(value byte) {
 
 func (m *Mapper4) writeIRQReload(value byte) {
 	m.counter = 0
+	m.irqReload = true
 }
 
 func (m *Mapper4) writeIRQDisable(value byte) {
@@ -3,7 +3,6 @@ package nes
 import (
 	"encoding/gob"
 	"fmt"
-	"log"
 )
 
 type Mapper40 struct {
@@ -55,9 +54,8 @@ func (m *Mapper40) Read(address uint16) byte {
 	case address >= 0xe000:
 		return m.PRG[address-0xe000+0x2000*7]
 	default:
-		log.Fatalf("unhandled mapper40 read at address: 0x%04X", address)
+		panic(AddressError{"mapper40", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper40) Write(address uint16, value byte) {
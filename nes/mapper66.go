@@ -0,0 +1,64 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/GxROM
+
+type Mapper66 struct {
+	*Cartridge
+	prgBank int
+	chrBank int
+}
+
+func NewMapper66(cartridge *Cartridge) Mapper {
+	return &Mapper66{cartridge, 0, 0}
+}
+
+func (m *Mapper66) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBank)
+	return nil
+}
+
+func (m *Mapper66) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBank)
+	return nil
+}
+
+func (m *Mapper66) Step() {
+}
+
+func (m *Mapper66) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		return m.CHR[index]
+	case address >= 0x8000:
+		index := (m.prgBank*0x8000 + int(address-0x8000)) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		return m.SRAM[index]
+	default:
+		panic(AddressError{"mapper66", false, address})
+	}
+}
+
+func (m *Mapper66) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		m.CHR[index] = value
+	case address >= 0x8000:
+		// bus conflict: the ROM drives the data bus at the same time
+		value &= m.Read(address)
+		m.prgBank = int(value>>4&0x03) % prgBanks32K(m.Cartridge)
+		m.chrBank = int(value&0x03) % (len(m.CHR) / 0x2000)
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		m.SRAM[index] = value
+	default:
+		panic(AddressError{"mapper66", true, address})
+	}
+}
@@ -0,0 +1,354 @@
+package nes
+
+import (
+	"encoding/gob"
+	"math"
+)
+
+// https://wiki.nesdev.com/w/index.php/Sunsoft_FME-7
+// https://wiki.nesdev.com/w/index.php/Sunsoft_5B_audio
+
+type Mapper69 struct {
+	*Cartridge
+	console       *Console
+	command       byte
+	chrBanks      [8]byte
+	prgBanks      [4]byte // $6000, $8000, $A000, $C000
+	ramSelect     bool
+	ramEnable     bool
+	irqEnable     bool
+	counterEnable bool
+	counter       uint16
+	audio         Sunsoft5B
+}
+
+func NewMapper69(console *Console, cartridge *Cartridge) Mapper {
+	m := Mapper69{Cartridge: cartridge, console: console}
+	m.audio.noiseShift = 1
+	return &m
+}
+
+func (m *Mapper69) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.command)
+	encoder.Encode(m.chrBanks)
+	encoder.Encode(m.prgBanks)
+	encoder.Encode(m.ramSelect)
+	encoder.Encode(m.ramEnable)
+	encoder.Encode(m.irqEnable)
+	encoder.Encode(m.counterEnable)
+	encoder.Encode(m.counter)
+	m.audio.Save(encoder)
+	return nil
+}
+
+func (m *Mapper69) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.command)
+	decoder.Decode(&m.chrBanks)
+	decoder.Decode(&m.prgBanks)
+	decoder.Decode(&m.ramSelect)
+	decoder.Decode(&m.ramEnable)
+	decoder.Decode(&m.irqEnable)
+	decoder.Decode(&m.counterEnable)
+	decoder.Decode(&m.counter)
+	m.audio.Load(decoder)
+	return nil
+}
+
+func (m *Mapper69) Step() {
+}
+
+// StepCPU decrements the IRQ counter, which fires when it wraps from $0000
+// to $FFFF, and clocks the 5B audio.
+func (m *Mapper69) StepCPU() {
+	if m.counterEnable {
+		m.counter--
+		if m.counter == 0xFFFF && m.irqEnable {
+			m.console.CPU.triggerIRQ()
+		}
+	}
+	m.audio.step()
+}
+
+func (m *Mapper69) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *Mapper69) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x0400
+		offset := address % 0x0400
+		return m.CHR[m.chrBankOffset(int(m.chrBanks[bank]))+int(offset)]
+	case address >= 0xE000:
+		return m.PRG[m.prgBankOffset(-1)+int(address-0xE000)]
+	case address >= 0x8000:
+		bank := (address-0x8000)/0x2000 + 1
+		offset := address % 0x2000
+		return m.PRG[m.prgBankOffset(int(m.prgBanks[bank]))+int(offset)]
+	case address >= 0x6000:
+		offset := int(address) - 0x6000
+		if !m.ramSelect {
+			return m.PRG[m.prgBankOffset(int(m.prgBanks[0]))+offset]
+		}
+		if m.ramEnable {
+			return m.SRAM[offset]
+		}
+		return 0
+	default:
+		panic(AddressError{"mapper69", false, address})
+	}
+}
+
+func (m *Mapper69) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		bank := address / 0x0400
+		offset := address % 0x0400
+		m.CHR[m.chrBankOffset(int(m.chrBanks[bank]))+int(offset)] = value
+	case address >= 0xE000:
+		m.audio.writeData(value)
+	case address >= 0xC000:
+		m.audio.writeAddress(value)
+	case address >= 0xA000:
+		m.writeParameter(value)
+	case address >= 0x8000:
+		m.command = value & 0x0F
+	case address >= 0x6000:
+		if m.ramSelect && m.ramEnable {
+			m.SRAM[int(address)-0x6000] = value
+		}
+	default:
+		panic(AddressError{"mapper69", true, address})
+	}
+}
+
+func (m *Mapper69) writeParameter(value byte) {
+	switch m.command {
+	case 0, 1, 2, 3, 4, 5, 6, 7:
+		m.chrBanks[m.command] = value
+	case 8:
+		m.prgBanks[0] = value & 0x3F
+		m.ramSelect = value&0x40 == 0x40
+		m.ramEnable = value&0x80 == 0x80
+	case 9, 10, 11:
+		m.prgBanks[m.command-8] = value & 0x3F
+	case 12:
+		switch value & 3 {
+		case 0:
+			m.Cartridge.Mirror = MirrorVertical
+		case 1:
+			m.Cartridge.Mirror = MirrorHorizontal
+		case 2:
+			m.Cartridge.Mirror = MirrorSingle0
+		case 3:
+			m.Cartridge.Mirror = MirrorSingle1
+		}
+	case 13:
+		m.irqEnable = value&0x01 == 0x01
+		m.counterEnable = value&0x80 == 0x80
+	case 14:
+		m.counter = (m.counter & 0xFF00) | uint16(value)
+	case 15:
+		m.counter = (m.counter & 0x00FF) | uint16(value)<<8
+	}
+}
+
+func (m *Mapper69) prgBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.PRG) / 0x2000
+	offset := index * 0x2000
+	if offset < 0 {
+		offset += len(m.PRG)
+	}
+	return offset
+}
+
+func (m *Mapper69) chrBankOffset(index int) int {
+	if index >= 0x80 {
+		index -= 0x100
+	}
+	index %= len(m.CHR) / 0x0400
+	offset := index * 0x0400
+	if offset < 0 {
+		offset += len(m.CHR)
+	}
+	return offset
+}
+
+// Sunsoft 5B
+
+var sunsoft5BVolumeTable [32]float32
+
+func init() {
+	// 32 logarithmic steps of 1.5 dB, scaled so that a single channel at full
+	// volume is about as loud as a single APU pulse channel
+	for i := 1; i < 32; i++ {
+		db := float64(31-i) * 1.5
+		sunsoft5BVolumeTable[i] = float32(0.15 * math.Pow(10, -db/20))
+	}
+}
+
+// Sunsoft5B is the YM2149F derived sound chip in the Sunsoft 5B: three
+// square channels, one noise generator and one envelope generator.
+type Sunsoft5B struct {
+	register          byte
+	registers         [16]byte
+	divider           byte
+	toneCounters      [3]uint16
+	toneOutputs       [3]bool
+	noiseCounter      byte
+	noiseToggle       bool
+	noiseShift        uint32
+	envelopeCounter   uint16
+	envelopeValue     byte
+	envelopeDirection int8
+	envelopeHolding   bool
+}
+
+func (s *Sunsoft5B) Save(encoder *gob.Encoder) error {
+	encoder.Encode(s.register)
+	encoder.Encode(s.registers)
+	encoder.Encode(s.divider)
+	encoder.Encode(s.toneCounters)
+	encoder.Encode(s.toneOutputs)
+	encoder.Encode(s.noiseCounter)
+	encoder.Encode(s.noiseToggle)
+	encoder.Encode(s.noiseShift)
+	encoder.Encode(s.envelopeCounter)
+	encoder.Encode(s.envelopeValue)
+	encoder.Encode(s.envelopeDirection)
+	encoder.Encode(s.envelopeHolding)
+	return nil
+}
+
+func (s *Sunsoft5B) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&s.register)
+	decoder.Decode(&s.registers)
+	decoder.Decode(&s.divider)
+	decoder.Decode(&s.toneCounters)
+	decoder.Decode(&s.toneOutputs)
+	decoder.Decode(&s.noiseCounter)
+	decoder.Decode(&s.noiseToggle)
+	decoder.Decode(&s.noiseShift)
+	decoder.Decode(&s.envelopeCounter)
+	decoder.Decode(&s.envelopeValue)
+	decoder.Decode(&s.envelopeDirection)
+	decoder.Decode(&s.envelopeHolding)
+	return nil
+}
+
+// $C000: audio register select
+func (s *Sunsoft5B) writeAddress(value byte) {
+	s.register = value & 0x0F
+}
+
+// $E000: audio register write
+func (s *Sunsoft5B) writeData(value byte) {
+	s.registers[s.register] = value
+	if s.register == 0x0D {
+		// writing the shape restarts the envelope
+		s.envelopeCounter = 0
+		s.envelopeHolding = false
+		if value&0x04 == 0x04 {
+			s.envelopeValue = 0
+			s.envelopeDirection = 1
+		} else {
+			s.envelopeValue = 31
+			s.envelopeDirection = -1
+		}
+	}
+}
+
+func (s *Sunsoft5B) tonePeriod(channel int) uint16 {
+	lo := uint16(s.registers[channel*2])
+	hi := uint16(s.registers[channel*2+1] & 0x0F)
+	return hi<<8 | lo
+}
+
+func (s *Sunsoft5B) envelopePeriod() uint16 {
+	return uint16(s.registers[0x0C])<<8 | uint16(s.registers[0x0B])
+}
+
+// step is called once per CPU cycle. The tone and noise generators run at
+// CPU/16 and the envelope at CPU/8.
+func (s *Sunsoft5B) step() {
+	s.divider++
+	if s.divider%8 == 0 {
+		s.stepEnvelopeTimer()
+	}
+	if s.divider%16 != 0 {
+		return
+	}
+	for i := range s.toneCounters {
+		s.toneCounters[i]++
+		if s.toneCounters[i] >= s.tonePeriod(i) {
+			s.toneCounters[i] = 0
+			s.toneOutputs[i] = !s.toneOutputs[i]
+		}
+	}
+	s.noiseCounter++
+	if s.noiseCounter >= s.registers[6]&0x1F {
+		s.noiseCounter = 0
+		s.noiseToggle = !s.noiseToggle
+		if s.noiseToggle {
+			feedback := (s.noiseShift ^ (s.noiseShift >> 3)) & 1
+			s.noiseShift = (s.noiseShift >> 1) | (feedback << 16)
+		}
+	}
+}
+
+func (s *Sunsoft5B) stepEnvelopeTimer() {
+	s.envelopeCounter++
+	if s.envelopeCounter < s.envelopePeriod() {
+		return
+	}
+	s.envelopeCounter = 0
+	if s.envelopeHolding {
+		return
+	}
+	next := int(s.envelopeValue) + int(s.envelopeDirection)
+	if next >= 0 && next <= 31 {
+		s.envelopeValue = byte(next)
+		return
+	}
+	shape := s.registers[0x0D]
+	continues := shape&0x08 == 0x08
+	alternate := shape&0x02 == 0x02
+	hold := shape&0x01 == 0x01
+	switch {
+	case !continues:
+		s.envelopeValue = 0
+		s.envelopeHolding = true
+	case hold:
+		if alternate {
+			s.envelopeValue ^= 31
+		}
+		s.envelopeHolding = true
+	case alternate:
+		s.envelopeDirection = -s.envelopeDirection
+	default:
+		s.envelopeValue ^= 31
+	}
+}
+
+func (s *Sunsoft5B) output() float32 {
+	mixer := s.registers[7]
+	noise := s.noiseShift&1 == 1
+	var result float32
+	for i := uint(0); i < 3; i++ {
+		toneOff := (mixer>>i)&1 == 1
+		noiseOff := (mixer>>(i+3))&1 == 1
+		if !(s.toneOutputs[i] || toneOff) || !(noise || noiseOff) {
+			continue
+		}
+		volume := s.registers[8+i]
+		if volume&0x10 == 0x10 {
+			result += sunsoft5BVolumeTable[s.envelopeValue]
+		} else if volume&0x0F != 0 {
+			result += sunsoft5BVolumeTable[(volume&0x0F)*2+1]
+		}
+	}
+	return result
+}
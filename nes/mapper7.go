@@ -1,9 +1,6 @@
 package nes
 
-import (
-	"encoding/gob"
-	"log"
-)
+import "encoding/gob"
 
 type Mapper7 struct {
 	*Cartridge
@@ -38,9 +35,8 @@ func (m *Mapper7) Read(address uint16) byte {
 		index := int(address) - 0x6000
 		return m.SRAM[index]
 	default:
-		log.Fatalf("unhandled mapper7 read at address: 0x%04X", address)
+		panic(AddressError{"mapper7", false, address})
 	}
-	return 0
 }
 
 func (m *Mapper7) Write(address uint16, value byte) {
@@ -59,6 +55,6 @@ func (m *Mapper7) Write(address uint16, value byte) {
 		index := int(address) - 0x6000
 		m.SRAM[index] = value
 	default:
-		log.Fatalf("unhandled mapper7 write at address: 0x%04X", address)
+		panic(AddressError{"mapper7", true, address})
 	}
 }
@@ -0,0 +1,78 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_071
+
+type Mapper71 struct {
+	*Cartridge
+	prgBanks int
+	prgBank1 int
+	prgBank2 int
+}
+
+func NewMapper71(cartridge *Cartridge) Mapper {
+	prgBanks := len(cartridge.PRG) / 0x4000
+	return &Mapper71{cartridge, prgBanks, 0, prgBanks - 1}
+}
+
+func (m *Mapper71) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBanks)
+	encoder.Encode(m.prgBank1)
+	encoder.Encode(m.prgBank2)
+	return nil
+}
+
+func (m *Mapper71) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBanks)
+	decoder.Decode(&m.prgBank1)
+	decoder.Decode(&m.prgBank2)
+	return nil
+}
+
+func (m *Mapper71) Step() {
+}
+
+func (m *Mapper71) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return m.CHR[address]
+	case address >= 0xC000:
+		index := m.prgBank2*0x4000 + int(address-0xC000)
+		return m.PRG[index]
+	case address >= 0x8000:
+		index := m.prgBank1*0x4000 + int(address-0x8000)
+		return m.PRG[index]
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		return m.SRAM[index]
+	default:
+		panic(AddressError{"mapper71", false, address})
+	}
+}
+
+func (m *Mapper71) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		m.CHR[address] = value
+	case address >= 0xC000:
+		m.prgBank1 = int(value) % m.prgBanks
+	case address >= 0x8000 && address < 0xA000 && (address >= 0x9000 || m.SubMapper == 1):
+		// submapper 1 is the BF9097 board used by Fire Hawk, which adds
+		// single-screen mirroring control at $8000-$9FFF. Most dumps of
+		// Fire Hawk are not marked as such, but it is the only game that
+		// writes to $9000-$9FFF, so those writes are always honored.
+		switch value & 0x10 {
+		case 0x00:
+			m.Cartridge.Mirror = MirrorSingle0
+		case 0x10:
+			m.Cartridge.Mirror = MirrorSingle1
+		}
+	case address >= 0x8000:
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		m.SRAM[index] = value
+	default:
+		panic(AddressError{"mapper71", true, address})
+	}
+}
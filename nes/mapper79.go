@@ -0,0 +1,74 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/NINA-003-006
+
+type Mapper79 struct {
+	*Cartridge
+	prgBank int
+	chrBank int
+}
+
+func NewMapper79(cartridge *Cartridge) Mapper {
+	return &Mapper79{cartridge, 0, 0}
+}
+
+func (m *Mapper79) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.prgBank)
+	encoder.Encode(m.chrBank)
+	return nil
+}
+
+func (m *Mapper79) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.prgBank)
+	decoder.Decode(&m.chrBank)
+	return nil
+}
+
+func (m *Mapper79) Step() {
+}
+
+func (m *Mapper79) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		return m.CHR[index]
+	case address >= 0x8000:
+		index := (m.prgBank*0x8000 + int(address-0x8000)) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		return m.SRAM[index]
+	default:
+		panic(AddressError{"mapper79", false, address})
+	}
+}
+
+func (m *Mapper79) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		m.CHR[index] = value
+	case address >= 0x8000:
+	case address >= 0x6000:
+		index := int(address) - 0x6000
+		m.SRAM[index] = value
+	default:
+		panic(AddressError{"mapper79", true, address})
+	}
+}
+
+func (m *Mapper79) ReadExpansion(address uint16) byte {
+	return 0
+}
+
+// WriteExpansion handles the bank register, which is decoded at any address
+// in $4100-$5FFF with A8 set and A13-A15 clear.
+func (m *Mapper79) WriteExpansion(address uint16, value byte) {
+	if address&0xE100 != 0x4100 {
+		return
+	}
+	m.prgBank = int(value>>3&1) % prgBanks32K(m.Cartridge)
+	m.chrBank = int(value&0x07) % (len(m.CHR) / 0x2000)
+}
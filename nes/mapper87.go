@@ -0,0 +1,58 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_087
+
+type Mapper87 struct {
+	*Cartridge
+	chrBank int
+}
+
+func NewMapper87(cartridge *Cartridge) Mapper {
+	return &Mapper87{cartridge, 0}
+}
+
+func (m *Mapper87) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.chrBank)
+	return nil
+}
+
+func (m *Mapper87) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.chrBank)
+	return nil
+}
+
+func (m *Mapper87) Step() {
+}
+
+func (m *Mapper87) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		return m.CHR[index]
+	case address >= 0x8000:
+		index := int(address-0x8000) % len(m.PRG)
+		return m.PRG[index]
+	case address >= 0x6000:
+		// the bank register is write only and there is no PRG RAM
+		return 0
+	default:
+		panic(AddressError{"mapper87", false, address})
+	}
+}
+
+func (m *Mapper87) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		index := m.chrBank*0x2000 + int(address)
+		m.CHR[index] = value
+	case address >= 0x8000:
+	case address >= 0x6000:
+		// the two bank bits are wired in reverse order
+		bank := int(value&1)<<1 | int(value>>1&1)
+		m.chrBank = bank % (len(m.CHR) / 0x2000)
+	default:
+		panic(AddressError{"mapper87", true, address})
+	}
+}
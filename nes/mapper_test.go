@@ -0,0 +1,340 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func newTestCartridge(mapper byte, prgBanks, chrBanks int) *Cartridge {
+	prg := make([]byte, prgBanks*0x4000)
+	chr := make([]byte, chrBanks*0x2000)
+	for i := range prg {
+		prg[i] = byte(i / 0x2000)
+	}
+	for i := range chr {
+		chr[i] = byte(i / 0x1000)
+	}
+	return NewCartridge(prg, chr, mapper, MirrorVertical, 0)
+}
+
+func TestMapper9Latch(t *testing.T) {
+	cartridge := newTestCartridge(9, 8, 4)
+	m := NewMapper9(cartridge).(*Mapper9)
+	m.Write(0xB000, 1) // $FD/$0000
+	m.Write(0xC000, 2) // $FE/$0000
+	if got := m.Read(0x0000); got != 2 {
+		t.Fatalf("expected $FE bank at power on, got %d", got)
+	}
+	m.WatchPPUAddress(0x0FD8)
+	if got := m.Read(0x0000); got != 1 {
+		t.Fatalf("expected $FD bank after $0FD8 fetch, got %d", got)
+	}
+	// MMC2 latch 0 only responds to the exact address
+	m.WatchPPUAddress(0x0FE9)
+	if got := m.Read(0x0000); got != 1 {
+		t.Fatalf("latch 0 should ignore $0FE9, got bank %d", got)
+	}
+	m.WatchPPUAddress(0x0FE8)
+	if got := m.Read(0x0000); got != 2 {
+		t.Fatalf("expected $FE bank after $0FE8 fetch, got %d", got)
+	}
+}
+
+func TestMapper10Latch(t *testing.T) {
+	cartridge := newTestCartridge(10, 8, 4)
+	m := NewMapper10(cartridge).(*Mapper10)
+	m.Write(0xD000, 3) // $FD/$1000
+	m.Write(0xE000, 5) // $FE/$1000
+	m.WatchPPUAddress(0x1FDC)
+	if got := m.Read(0x1000); got != 3 {
+		t.Fatalf("expected $FD bank after $1FDC fetch, got %d", got)
+	}
+	m.WatchPPUAddress(0x0FEB)
+	m.WatchPPUAddress(0x1FEF)
+	if got := m.Read(0x1000); got != 5 {
+		t.Fatalf("expected $FE bank after $1FEF fetch, got %d", got)
+	}
+	if got := m.Read(0xC000); got != 14 {
+		t.Fatalf("expected last 16KB bank fixed at $C000, got %d", got)
+	}
+}
+
+func stepMapper(m Mapper, cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.Step()
+	}
+}
+
+func TestMapper4A12Filter(t *testing.T) {
+	console := &Console{CPU: &CPU{}}
+	cartridge := newTestCartridge(4, 8, 8)
+	m := NewMapper4(console, cartridge).(*Mapper4)
+	m.Write(0xC000, 2) // latch
+	m.Write(0xC001, 0) // reload
+	m.Write(0xE001, 0) // enable
+	// a long low period followed by a rise clocks the counter
+	m.WatchPPUAddress(0x0000)
+	stepMapper(m, 64)
+	m.WatchPPUAddress(0x1000)
+	if m.counter != 2 {
+		t.Fatalf("expected counter reloaded to 2, got %d", m.counter)
+	}
+	// short low pulses, like nametable fetches between pattern
+	// fetches, are filtered out
+	for i := 0; i < 8; i++ {
+		stepMapper(m, 2)
+		m.WatchPPUAddress(0x2000)
+		stepMapper(m, 4)
+		m.WatchPPUAddress(0x1000)
+	}
+	if m.counter != 2 {
+		t.Fatalf("expected filtered rises to be ignored, got counter %d", m.counter)
+	}
+	m.WatchPPUAddress(0x0000)
+	stepMapper(m, 64)
+	m.WatchPPUAddress(0x1000)
+	if m.counter != 1 {
+		t.Fatalf("expected counter 1, got %d", m.counter)
+	}
+}
+
+func TestMapper4Revisions(t *testing.T) {
+	for _, submapper := range []byte{0, 4} {
+		console := &Console{CPU: &CPU{}}
+		cartridge := newTestCartridge(4, 8, 8)
+		cartridge.SubMapper = submapper
+		m := NewMapper4(console, cartridge).(*Mapper4)
+		m.Write(0xC000, 0) // latch of zero
+		m.Write(0xC001, 0)
+		m.Write(0xE001, 0)
+		m.HandleScanLine()
+		irq := console.CPU.interrupt == interruptIRQ
+		console.CPU.interrupt = interruptNone
+		m.HandleScanLine()
+		irqAgain := console.CPU.interrupt == interruptIRQ
+		if submapper == 4 {
+			// MMC3A only fires when the reload flag was set
+			if !irq || irqAgain {
+				t.Fatalf("MMC3A: expected IRQ on reload only, got %v %v", irq, irqAgain)
+			}
+		} else {
+			// MMC3B/C fire on every clock with a latch of zero
+			if !irq || !irqAgain {
+				t.Fatalf("MMC3C: expected IRQ on every clock, got %v %v", irq, irqAgain)
+			}
+		}
+	}
+}
+
+func TestMapper69IRQ(t *testing.T) {
+	console := &Console{CPU: &CPU{}}
+	cartridge := newTestCartridge(69, 8, 8)
+	m := NewMapper69(console, cartridge).(*Mapper69)
+	m.Write(0x8000, 0x0E)
+	m.Write(0xA000, 3) // counter low
+	m.Write(0x8000, 0x0F)
+	m.Write(0xA000, 0) // counter high
+	m.Write(0x8000, 0x0D)
+	m.Write(0xA000, 0x81) // counter and IRQ enable
+	for i := 0; i < 3; i++ {
+		m.StepCPU()
+	}
+	if console.CPU.interrupt == interruptIRQ {
+		t.Fatalf("IRQ fired before counter wrapped")
+	}
+	m.StepCPU()
+	if console.CPU.interrupt != interruptIRQ {
+		t.Fatalf("expected IRQ when counter wraps to $FFFF")
+	}
+	if m.counter != 0xFFFF {
+		t.Fatalf("expected counter $FFFF, got $%04X", m.counter)
+	}
+}
+
+func TestMapper19InternalRAM(t *testing.T) {
+	console := &Console{CPU: &CPU{}}
+	cartridge := newTestCartridge(19, 8, 8)
+	cartridge.Battery = 1
+	m := NewMapper19(console, cartridge).(*Mapper19)
+	m.Write(0xF800, 0x80|0x10) // address $10 with auto increment
+	for i := 0; i < 4; i++ {
+		m.WriteExpansion(0x4800, byte(i+1))
+	}
+	// the internal RAM lives in SRAM so battery saves include it
+	if got := cartridge.SRAM[namco163RAM+0x12]; got != 3 {
+		t.Fatalf("expected internal RAM in SRAM, got %d", got)
+	}
+	var buffer bytes.Buffer
+	m.Save(gob.NewEncoder(&buffer))
+	n := NewMapper19(console, newTestCartridge(19, 8, 8)).(*Mapper19)
+	n.Load(gob.NewDecoder(&buffer))
+	n.Write(0xF800, 0x80|0x10)
+	for i := 0; i < 4; i++ {
+		if got := n.ReadExpansion(0x4800); got != byte(i+1) {
+			t.Fatalf("expected %d at $%02X after load, got %d", i+1, 0x10+i, got)
+		}
+	}
+}
+
+func TestMapperBusConflicts(t *testing.T) {
+	cartridge := newTestCartridge(66, 8, 4)
+	m := NewMapper66(cartridge).(*Mapper66)
+	// PRG bank 0 reads back 0 everywhere, so the written bits are lost
+	m.Write(0x8000, 0x13)
+	if m.prgBank != 0 || m.chrBank != 0 {
+		t.Fatalf("expected bus conflict to clear the write, got %d %d", m.prgBank, m.chrBank)
+	}
+	// $FFFF in the first 32KB bank holds 3, so the low CHR bits survive
+	m.Write(0xFFFF, 0x13)
+	if m.prgBank != 0 || m.chrBank != 3 {
+		t.Fatalf("expected PRG 0 CHR 3, got %d %d", m.prgBank, m.chrBank)
+	}
+}
+
+func TestMapper16KPRG(t *testing.T) {
+	// a single 16KB bank is mirrored at $8000 and $C000
+	for _, m := range []Mapper{
+		NewMapper11(newTestCartridge(11, 1, 1)),
+		NewMapper34(newTestCartridge(34, 1, 1)),
+		NewMapper66(newTestCartridge(66, 1, 1)),
+		NewMapper140(newTestCartridge(140, 1, 1)),
+	} {
+		m.Write(0xFFFF, 0xFF)
+		m.Write(0x6000, 0x30)
+		if got := m.Read(0xC000); got != 0 {
+			t.Fatalf("%T: expected the first bank at $C000, got %d", m, got)
+		}
+	}
+}
+
+func TestMapper71SRAM(t *testing.T) {
+	cartridge := newTestCartridge(71, 4, 1)
+	cartridge.SubMapper = 1
+	m := NewMapper71(cartridge)
+	m.Write(0x6000, 0x10)
+	if got := m.Read(0x6000); got != 0x10 || cartridge.Mirror != MirrorVertical {
+		t.Fatalf("expected an SRAM store, got %d with mirroring %d", got, cartridge.Mirror)
+	}
+	m.Write(0x8000, 0x10)
+	if cartridge.Mirror != MirrorSingle1 {
+		t.Fatalf("expected single screen mirroring, got %d", cartridge.Mirror)
+	}
+}
+
+func TestMapper34Boards(t *testing.T) {
+	// NINA-001 has CHR-ROM larger than 8KB and registers at $7FFD-$7FFF
+	m := NewMapper34(newTestCartridge(34, 4, 4)).(*Mapper34)
+	m.Write(0x7FFE, 5)
+	if got := m.Read(0x0000); got != 5 {
+		t.Fatalf("expected NINA-001 CHR bank 5, got %d", got)
+	}
+	// BNROM has CHR-RAM and a single register at $8000-$FFFF
+	m = NewMapper34(newTestCartridge(34, 4, 1)).(*Mapper34)
+	m.Write(0x7FFD, 1)
+	if m.prgBank != 0 {
+		t.Fatalf("BNROM should ignore $7FFD, got PRG bank %d", m.prgBank)
+	}
+	// the submapper overrides the CHR size heuristic
+	cartridge := newTestCartridge(34, 4, 4)
+	cartridge.SubMapper = 2
+	m = NewMapper34(cartridge).(*Mapper34)
+	if m.nina {
+		t.Fatalf("expected submapper 2 to select BNROM")
+	}
+}
+
+func TestMapper79Register(t *testing.T) {
+	m := NewMapper79(newTestCartridge(79, 4, 4)).(*Mapper79)
+	m.WriteExpansion(0x4100, 0x0B)
+	if m.prgBank != 1 || m.chrBank != 3 {
+		t.Fatalf("expected PRG 1 CHR 3, got %d %d", m.prgBank, m.chrBank)
+	}
+	// A8 clear does not select the register
+	m.WriteExpansion(0x4200, 0x00)
+	if m.prgBank != 1 || m.chrBank != 3 {
+		t.Fatalf("write with A8 clear should be ignored")
+	}
+}
+
+func newTestDisk() []byte {
+	side := make([]byte, fdsSideSize)
+	side[0] = 1
+	copy(side[1:], "*NINTENDO-HVC*")
+	side[56] = 2 // file amount
+	side[57] = 1
+	side[58] = 3 // file header with 2 bytes of data
+	side[58+13] = 2
+	side[74] = 4 // file data
+	side[75] = 0xAB
+	side[76] = 0xCD
+	return side
+}
+
+func TestMapper20DiskRead(t *testing.T) {
+	cartridge, err := LoadFDS(newTestDisk(), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := &Console{CPU: &CPU{}}
+	m := NewMapper20(console, cartridge).(*Mapper20)
+	m.WriteExpansion(0x4025, 0x45) // motor on, read mode, disk ready
+	var data []byte
+	for i := 0; i < 1000000 && len(data) < 4; i++ {
+		m.StepCPU()
+		if m.transferDone {
+			data = append(data, m.ReadExpansion(0x4031))
+		}
+	}
+	expected := []byte{0x80, 0x01, '*', 'N'}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestMapper20DiskSave(t *testing.T) {
+	cartridge, err := LoadFDS(newTestDisk(), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := &Console{CPU: &CPU{}}
+	m := NewMapper20(console, cartridge).(*Mapper20)
+	m.sides[0][0x1000] = 0x5A
+	var buffer bytes.Buffer
+	m.Save(gob.NewEncoder(&buffer))
+	// only the written byte of the disk is saved, besides the RAM
+	if buffer.Len() > len(m.ram)+1024 {
+		t.Fatalf("expected the disk to be saved as a diff, got %d bytes", buffer.Len())
+	}
+	n := NewMapper20(console, cartridge).(*Mapper20)
+	n.Load(gob.NewDecoder(&buffer))
+	if n.sides[0][0x1000] != 0x5A {
+		t.Fatalf("expected disk writes to be restored by Load")
+	}
+	n.InsertDisk(0)
+	if n.ReadExpansion(0x4032)&0x01 == 0 {
+		t.Fatalf("expected drive to be empty while swapping disks")
+	}
+}
+
+func TestFDSDiff(t *testing.T) {
+	original := fdsRawSide(newTestDisk())
+	if diff := fdsDiff(original, original); len(diff) != 0 {
+		t.Fatalf("expected an empty diff, got %d bytes", len(diff))
+	}
+	side := append([]byte(nil), original...)
+	side[0] ^= 1
+	side[100] ^= 1
+	side[101] ^= 1
+	side[len(side)-1] ^= 1
+	diff := fdsDiff(original, side)
+	if len(diff) > 16 {
+		t.Fatalf("expected a small diff, got %d bytes", len(diff))
+	}
+	if patched := fdsPatch(original, diff); !bytes.Equal(patched, side) {
+		t.Fatalf("expected the patched side to match")
+	}
+	if original[0] == side[0] {
+		t.Fatalf("expected the original to be left alone")
+	}
+}
@@ -1,20 +1,40 @@
 package nes
 
-import "log"
+import "fmt"
 
 type Memory interface {
 	Read(address uint16) byte
 	Write(address uint16, value byte)
 }
 
+// AddressError is the panic value of a memory access that the memory map or
+// the mapper does not handle. Only a bad ROM or state causes one, so the
+// emulator lets it crash, while headless replays recover it and reject the
+// session.
+type AddressError struct {
+	Device  string // "cpu memory", "ppu memory" or the mapper
+	Write   bool
+	Address uint16
+}
+
+func (e AddressError) Error() string {
+	op := "read"
+	if e.Write {
+		op = "write"
+	}
+	return fmt.Sprintf("unhandled %s %s at address: 0x%04X", e.Device, op, e.Address)
+}
+
 // CPU Memory Map
 
 type cpuMemory struct {
-	console *Console
+	console   *Console
+	expansion ExpansionMemory
 }
 
 func NewCPUMemory(console *Console) Memory {
-	return &cpuMemory{console}
+	expansion, _ := console.Mapper.(ExpansionMemory)
+	return &cpuMemory{console, expansion}
 }
 
 func (mem *cpuMemory) Read(address uint16) byte {
@@ -28,15 +48,19 @@ func (mem *cpuMemory) Read(address uint16) byte {
 	case address == 0x4015:
 		return mem.console.APU.readRegister(address)
 	case address == 0x4016:
-		return mem.console.Controller1.Read()
+		return mem.console.Port1.Read()
 	case address == 0x4017:
-		return mem.console.Controller2.Read()
-	case address < 0x6000:
+		return mem.console.Port2.Read()
+	case address < 0x4020:
 		// TODO: I/O registers
+	case address < 0x6000:
+		if mem.expansion != nil {
+			return mem.expansion.ReadExpansion(address)
+		}
 	case address >= 0x6000:
 		return mem.console.Mapper.Read(address)
 	default:
-		log.Fatalf("unhandled cpu memory read at address: 0x%04X", address)
+		panic(AddressError{"cpu memory", false, address})
 	}
 	return 0
 }
@@ -54,57 +78,82 @@ func (mem *cpuMemory) Write(address uint16, value byte) {
 	case address == 0x4015:
 		mem.console.APU.writeRegister(address, value)
 	case address == 0x4016:
-		mem.console.Controller1.Write(value)
-		mem.console.Controller2.Write(value)
+		mem.console.Port1.Write(value)
+		mem.console.Port2.Write(value)
 	case address == 0x4017:
 		mem.console.APU.writeRegister(address, value)
-	case address < 0x6000:
+	case address < 0x4020:
 		// TODO: I/O registers
+	case address < 0x6000:
+		if mem.expansion != nil {
+			mem.expansion.WriteExpansion(address, value)
+		}
 	case address >= 0x6000:
 		mem.console.Mapper.Write(address, value)
 	default:
-		log.Fatalf("unhandled cpu memory write at address: 0x%04X", address)
+		panic(AddressError{"cpu memory", true, address})
 	}
 }
 
 // PPU Memory Map
 
 type ppuMemory struct {
-	console *Console
+	console    *Console
+	watcher    PPUAddressWatcher
+	nameTables NameTableMapper
 }
 
 func NewPPUMemory(console *Console) Memory {
-	return &ppuMemory{console}
+	watcher, _ := console.Mapper.(PPUAddressWatcher)
+	nameTables, _ := console.Mapper.(NameTableMapper)
+	return &ppuMemory{console, watcher, nameTables}
 }
 
 func (mem *ppuMemory) Read(address uint16) byte {
 	address = address % 0x4000
+	value := mem.read(address)
+	if mem.watcher != nil {
+		mem.watcher.WatchPPUAddress(address)
+	}
+	return value
+}
+
+func (mem *ppuMemory) read(address uint16) byte {
 	switch {
 	case address < 0x2000:
 		return mem.console.Mapper.Read(address)
 	case address < 0x3F00:
+		if mem.nameTables != nil {
+			return mem.nameTables.ReadNameTable(address)
+		}
 		mode := mem.console.Cartridge.Mirror
 		return mem.console.PPU.nameTableData[MirrorAddress(mode, address)%2048]
 	case address < 0x4000:
 		return mem.console.PPU.readPalette(address % 32)
 	default:
-		log.Fatalf("unhandled ppu memory read at address: 0x%04X", address)
+		panic(AddressError{"ppu memory", false, address})
 	}
-	return 0
 }
 
 func (mem *ppuMemory) Write(address uint16, value byte) {
 	address = address % 0x4000
+	if mem.watcher != nil {
+		mem.watcher.WatchPPUAddress(address)
+	}
 	switch {
 	case address < 0x2000:
 		mem.console.Mapper.Write(address, value)
 	case address < 0x3F00:
+		if mem.nameTables != nil {
+			mem.nameTables.WriteNameTable(address, value)
+			return
+		}
 		mode := mem.console.Cartridge.Mirror
 		mem.console.PPU.nameTableData[MirrorAddress(mode, address)%2048] = value
 	case address < 0x4000:
 		mem.console.PPU.writePalette(address%32, value)
 	default:
-		log.Fatalf("unhandled ppu memory write at address: 0x%04X", address)
+		panic(AddressError{"ppu memory", true, address})
 	}
 }
 
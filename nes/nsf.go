@@ -0,0 +1,257 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	nsfFileMagic  = "NESM\x1a"
+	nsfeFileMagic = "NSFE"
+)
+
+// NSF expansion chip flags
+const (
+	NSFChipVRC6 = 1 << iota
+	NSFChipVRC7
+	NSFChipFDS
+	NSFChipMMC5
+	NSFChipN163
+	NSFChip5B
+)
+
+// NSF is a parsed NSF or NSFe music file.
+// https://wiki.nesdev.com/w/index.php/NSF
+// https://wiki.nesdev.com/w/index.php/NSFe
+type NSF struct {
+	Songs       int      // number of songs
+	StartSong   int      // first song to play (0-based)
+	LoadAddress uint16   // where Data is loaded
+	InitAddress uint16   // song init routine
+	PlayAddress uint16   // song play routine
+	Name        string   // song name
+	Artist      string   // artist
+	Copyright   string   // copyright holder
+	Speed       uint16   // NTSC play rate, in microseconds per call
+	Banks       [8]byte  // initial banks, all zero if not bankswitched
+	Chips       byte     // expansion chip flags
+	Data        []byte   // program and music data
+	Titles      []string // track titles (NSFe only)
+	Durations   []int    // track lengths in milliseconds (NSFe only)
+}
+
+// LoadNSFFile reads a .nsf or .nsfe file.
+func LoadNSFFile(path string) (*NSF, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadNSF(data)
+}
+
+// IsNSFFile reports whether path has a .nsf or .nsfe extension.
+func IsNSFFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nsf", ".nsfe":
+		return true
+	}
+	return false
+}
+
+// LoadNSF parses the contents of a .nsf or .nsfe file.
+func LoadNSF(data []byte) (*NSF, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(nsfFileMagic)):
+		return loadNSF(data)
+	case bytes.HasPrefix(data, []byte(nsfeFileMagic)):
+		return loadNSFE(data)
+	}
+	return nil, errors.New("invalid .nsf file")
+}
+
+type nsfFileHeader struct {
+	Magic       [5]byte
+	Version     byte
+	Songs       byte
+	StartSong   byte // 1-based
+	LoadAddress uint16
+	InitAddress uint16
+	PlayAddress uint16
+	Name        [32]byte
+	Artist      [32]byte
+	Copyright   [32]byte
+	SpeedNTSC   uint16
+	Banks       [8]byte
+	SpeedPAL    uint16
+	Region      byte
+	Chips       byte
+	_           [4]byte
+}
+
+func loadNSF(data []byte) (*NSF, error) {
+	header := nsfFileHeader{}
+	reader := bytes.NewReader(data)
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	nsf := NSF{
+		Songs:       int(header.Songs),
+		StartSong:   int(header.StartSong) - 1,
+		LoadAddress: header.LoadAddress,
+		InitAddress: header.InitAddress,
+		PlayAddress: header.PlayAddress,
+		Name:        nsfString(header.Name[:]),
+		Artist:      nsfString(header.Artist[:]),
+		Copyright:   nsfString(header.Copyright[:]),
+		Speed:       header.SpeedNTSC,
+		Banks:       header.Banks,
+		Chips:       header.Chips,
+		Data:        data[128:],
+	}
+	return nsf.validate()
+}
+
+func loadNSFE(data []byte) (*NSF, error) {
+	nsf := NSF{Speed: 16639}
+	var hasInfo, hasData bool
+	data = data[4:]
+	for len(data) >= 8 {
+		length := int(binary.LittleEndian.Uint32(data))
+		id := string(data[4:8])
+		data = data[8:]
+		if length > len(data) {
+			return nil, errors.New("truncated .nsfe chunk: " + id)
+		}
+		chunk := data[:length]
+		data = data[length:]
+		switch id {
+		case "INFO":
+			if len(chunk) < 8 {
+				return nil, errors.New("invalid .nsfe INFO chunk")
+			}
+			nsf.LoadAddress = binary.LittleEndian.Uint16(chunk[0:])
+			nsf.InitAddress = binary.LittleEndian.Uint16(chunk[2:])
+			nsf.PlayAddress = binary.LittleEndian.Uint16(chunk[4:])
+			nsf.Chips = chunk[7]
+			nsf.Songs = 1
+			if len(chunk) > 8 {
+				nsf.Songs = int(chunk[8])
+			}
+			if len(chunk) > 9 {
+				nsf.StartSong = int(chunk[9])
+			}
+			hasInfo = true
+		case "DATA":
+			nsf.Data = chunk
+			hasData = true
+		case "BANK":
+			copy(nsf.Banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				nsf.Speed = binary.LittleEndian.Uint16(chunk)
+			}
+		case "auth":
+			fields := strings.Split(string(chunk), "\x00")
+			for i, field := range fields {
+				switch i {
+				case 0:
+					nsf.Name = field
+				case 1:
+					nsf.Artist = field
+				case 2:
+					nsf.Copyright = field
+				}
+			}
+		case "tlbl":
+			nsf.Titles = strings.Split(strings.TrimSuffix(string(chunk), "\x00"), "\x00")
+		case "time":
+			for i := 0; i+4 <= len(chunk); i += 4 {
+				nsf.Durations = append(nsf.Durations, int(int32(binary.LittleEndian.Uint32(chunk[i:]))))
+			}
+		case "NEND":
+			data = nil
+		default:
+			// chunks with an upper case first letter are required
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, errors.New("unsupported .nsfe chunk: " + id)
+			}
+		}
+	}
+	if !hasInfo || !hasData {
+		return nil, errors.New("invalid .nsfe file")
+	}
+	return nsf.validate()
+}
+
+func (nsf *NSF) validate() (*NSF, error) {
+	if nsf.Songs < 1 {
+		return nil, errors.New("invalid .nsf file: no songs")
+	}
+	if nsf.StartSong < 0 || nsf.StartSong >= nsf.Songs {
+		nsf.StartSong = 0
+	}
+	if nsf.LoadAddress < 0x6000 {
+		return nil, errors.New("invalid .nsf file: load address below $6000")
+	}
+	if nsf.Speed == 0 {
+		nsf.Speed = 16639
+	}
+	return nsf, nil
+}
+
+// Bankswitched reports whether the file uses the $5FF8-$5FFF bank registers.
+func (nsf *NSF) Bankswitched() bool {
+	for _, bank := range nsf.Banks {
+		if bank != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// UnsupportedChips returns the names of the expansion chips the file uses
+// that the player does not emulate. Their channels are silent.
+func (nsf *NSF) UnsupportedChips() []string {
+	var names []string
+	for _, chip := range []struct {
+		flag byte
+		name string
+	}{
+		{NSFChipVRC6, "VRC6"},
+		{NSFChipVRC7, "VRC7"},
+		{NSFChipMMC5, "MMC5"},
+	} {
+		if nsf.Chips&chip.flag != 0 {
+			names = append(names, chip.name)
+		}
+	}
+	return names
+}
+
+// Title returns the name of a song, falling back to its number.
+func (nsf *NSF) Title(song int) string {
+	if song < len(nsf.Titles) && nsf.Titles[song] != "" {
+		return nsf.Titles[song]
+	}
+	return "Track " + strconv.Itoa(song+1)
+}
+
+// Duration returns the length of a song in milliseconds, or -1 if unknown.
+func (nsf *NSF) Duration(song int) int {
+	if song < len(nsf.Durations) {
+		return nsf.Durations[song]
+	}
+	return -1
+}
+
+func nsfString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
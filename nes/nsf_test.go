@@ -0,0 +1,87 @@
+package nes
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func newTestNSF() []byte {
+	data := make([]byte, 128)
+	copy(data, nsfFileMagic)
+	data[5] = 1 // version
+	data[6] = 2 // songs
+	data[7] = 1 // start song
+	binary.LittleEndian.PutUint16(data[8:], 0x8000)
+	binary.LittleEndian.PutUint16(data[10:], 0x8000)
+	binary.LittleEndian.PutUint16(data[12:], 0x8010)
+	copy(data[14:], "Test")
+	binary.LittleEndian.PutUint16(data[110:], 16639)
+	code := []byte{
+		// INIT: start a square wave on pulse 1
+		0xA9, 0xBF, 0x8D, 0x00, 0x40, // LDA #$BF; STA $4000
+		0xA9, 0xFD, 0x8D, 0x02, 0x40, // LDA #$FD; STA $4002
+		0xA9, 0x00, 0x8D, 0x03, 0x40, // LDA #$00; STA $4003
+		0x60, // RTS
+		// PLAY: count calls in $00
+		0xE6, 0x00, // INC $00
+		0x60, // RTS
+	}
+	return append(data, code...)
+}
+
+func TestNSFPlayer(t *testing.T) {
+	nsf, err := LoadNSF(newTestNSF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nsf.Name != "Test" || nsf.Songs != 2 || nsf.Bankswitched() {
+		t.Fatalf("unexpected header: %+v", nsf)
+	}
+	player := NewNSFPlayer(nsf)
+	channel := make(chan float32, 48000)
+	player.Console.SetAudioChannel(channel)
+	player.Console.SetAudioSampleRate(44100)
+	player.StepSeconds(1)
+	if calls := player.Console.RAM[0]; calls < 59 || calls > 61 {
+		t.Fatalf("expected about 60 PLAY calls per second, got %d", calls)
+	}
+	var peak float32
+	for len(channel) > 0 {
+		if sample := <-channel; sample > peak {
+			peak = sample
+		}
+	}
+	if peak == 0 {
+		t.Fatalf("expected INIT to start a tone")
+	}
+	player.Play(1)
+	if player.Console.RAM[0] != 0 || player.Song() != 1 {
+		t.Fatalf("expected Play to reset RAM and switch songs")
+	}
+}
+
+func TestNSFEShortInfo(t *testing.T) {
+	// an INFO chunk without the song count, which then defaults to one
+	data := []byte("NSFE")
+	chunk := func(id string, body []byte) {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(body)))
+		data = append(data, length[:]...)
+		data = append(data, id...)
+		data = append(data, body...)
+	}
+	chunk("INFO", []byte{0x00, 0x80, 0x00, 0x80, 0x10, 0x80, 0, NSFChipVRC6 | NSFChipMMC5 | NSFChipFDS})
+	chunk("DATA", []byte{0x60})
+	chunk("NEND", nil)
+	nsf, err := LoadNSF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nsf.Songs != 1 || nsf.PlayAddress != 0x8010 {
+		t.Fatalf("unexpected header: %+v", nsf)
+	}
+	if chips := strings.Join(nsf.UnsupportedChips(), " "); chips != "VRC6 MMC5" {
+		t.Fatalf("expected VRC6 and MMC5 to be unsupported, got %q", chips)
+	}
+}
@@ -0,0 +1,321 @@
+package nes
+
+import "encoding/gob"
+
+// The CPU returns from INIT and PLAY into an idle loop at nsfDriver, a JMP
+// to itself that the player mapper serves from the unused expansion area.
+const nsfDriver = 0x5FF0
+
+// NSFPlayer plays the songs of an NSF file by calling its INIT and PLAY
+// routines on a console with a synthetic cartridge.
+type NSFPlayer struct {
+	Console *Console
+	NSF     *NSF
+	mapper  *nsfMapper
+	song    int
+	period  int // CPU cycles between PLAY calls
+	cycles  int // CPU cycles until the next PLAY call
+}
+
+func NewNSFPlayer(nsf *NSF) *NSFPlayer {
+	cartridge := NewCartridge(nil, make([]byte, 0x2000), 0, MirrorHorizontal, 0)
+	meta := &MetaConfig{Headless: false, StepAPU: true}
+	console := Console{
+		MetaConfig:  meta,
+		Cartridge:   cartridge,
+		Controller1: NewController(),
+		Controller2: NewController(),
+		Controller3: NewController(),
+		Controller4: NewController(),
+		RAM:         make([]byte, 2048),
+	}
+	console.Port1 = console.Controller1
+	console.Port2 = console.Controller2
+	mapper := newNSFMapper(cartridge, nsf)
+	console.Mapper = mapper
+	console.cpuStepper = mapper
+	console.CPU = NewCPU(&console)
+	console.APU = NewAPU(&console)
+	console.PPU = NewPPU(&console)
+	period := int(float64(nsf.Speed) * CPUFrequency / 1000000)
+	player := NSFPlayer{&console, nsf, mapper, 0, period, 0}
+	player.Play(nsf.StartSong)
+	return &player
+}
+
+// Song returns the current song (0-based).
+func (p *NSFPlayer) Song() int {
+	return p.song
+}
+
+// Play resets the console and starts the given song (0-based).
+func (p *NSFPlayer) Play(song int) {
+	if song < 0 || song >= p.NSF.Songs {
+		return
+	}
+	p.song = song
+	console := p.Console
+	for i := range console.RAM {
+		console.RAM[i] = 0
+	}
+	p.mapper.reset()
+	cpu := console.CPU
+	for address := uint16(0x4000); address < 0x4014; address++ {
+		cpu.Write(address, 0)
+	}
+	cpu.Write(0x4015, 0x00)
+	cpu.Write(0x4015, 0x0F)
+	cpu.Write(0x4017, 0x40)
+	cpu.Reset()
+	cpu.A = byte(song)
+	cpu.X = 0 // NTSC
+	cpu.Y = 0
+	p.call(p.NSF.InitAddress)
+	p.cycles = 0
+}
+
+// call makes the CPU run a subroutine that returns to the idle loop.
+func (p *NSFPlayer) call(address uint16) {
+	cpu := p.Console.CPU
+	cpu.push16(nsfDriver - 1)
+	cpu.PC = address
+}
+
+func (p *NSFPlayer) idle() bool {
+	return p.Console.CPU.PC == nsfDriver
+}
+
+// Step runs one CPU instruction, calling PLAY when it is due and the
+// previous call has returned, and returns the number of CPU cycles taken.
+func (p *NSFPlayer) Step() int {
+	if p.cycles <= 0 && p.idle() {
+		p.cycles += p.period
+		if p.cycles <= 0 {
+			p.cycles = p.period
+		}
+		p.call(p.NSF.PlayAddress)
+	}
+	cycles := p.Console.Step()
+	p.cycles -= cycles
+	return cycles
+}
+
+func (p *NSFPlayer) StepSeconds(seconds float64) {
+	cycles := int(CPUFrequency * seconds)
+	for cycles > 0 {
+		cycles -= p.Step()
+	}
+}
+
+// nsfMapper maps the NSF data into $6000-$FFFF, handles the bank registers
+// at $5FF6-$5FFF and drives the supported expansion chips.
+type nsfMapper struct {
+	*Cartridge
+	nsf          *NSF
+	memory       []byte // $6000-$FFFF
+	banks        [10]byte
+	fds          *FDSAudio
+	n163         *Namco163Audio
+	n163RAM      [128]byte
+	n163Address  byte
+	n163Increase bool
+	s5b          *Sunsoft5B
+}
+
+func newNSFMapper(cartridge *Cartridge, nsf *NSF) *nsfMapper {
+	m := nsfMapper{Cartridge: cartridge, nsf: nsf}
+	m.memory = make([]byte, 0xA000)
+	if nsf.Bankswitched() {
+		// the data is split in 4KB pages, with the load address giving the
+		// offset of the data in the first page
+		padding := int(nsf.LoadAddress & 0x0FFF)
+		size := (padding + len(nsf.Data) + 0x0FFF) &^ 0x0FFF
+		m.PRG = make([]byte, size)
+		copy(m.PRG[padding:], nsf.Data)
+	}
+	if nsf.Chips&NSFChipFDS != 0 {
+		m.fds = &FDSAudio{}
+	}
+	if nsf.Chips&NSFChipN163 != 0 {
+		m.n163 = &Namco163Audio{}
+	}
+	if nsf.Chips&NSFChip5B != 0 {
+		m.s5b = &Sunsoft5B{}
+	}
+	m.reset()
+	return &m
+}
+
+func (m *nsfMapper) reset() {
+	for i := range m.memory {
+		m.memory[i] = 0
+	}
+	if m.nsf.Bankswitched() {
+		for i, bank := range m.nsf.Banks {
+			m.switchBank(2+i, bank)
+		}
+		if m.fds != nil {
+			// FDS files also bank $6000-$7FFF, starting with the pages
+			// that would otherwise be at $E000-$FFFF
+			m.switchBank(0, m.nsf.Banks[6])
+			m.switchBank(1, m.nsf.Banks[7])
+		}
+	} else {
+		copy(m.memory[m.nsf.LoadAddress-0x6000:], m.nsf.Data)
+	}
+	if m.fds != nil {
+		*m.fds = FDSAudio{}
+		m.fds.reset()
+		m.fds.writeRegister(0x4089, 0x80)
+		m.fds.writeRegister(0x408A, 0xE8)
+	}
+	if m.n163 != nil {
+		*m.n163 = Namco163Audio{}
+		m.n163RAM = [128]byte{}
+	}
+	if m.s5b != nil {
+		*m.s5b = Sunsoft5B{noiseShift: 1}
+	}
+}
+
+// switchBank copies a 4KB page of data into one of the ten 4KB windows at
+// $6000-$FFFF. Copying rather than mapping lets FDS files modify the data.
+func (m *nsfMapper) switchBank(window int, bank byte) {
+	m.banks[window] = bank
+	offset := int(bank) * 0x1000
+	page := m.memory[window*0x1000 : (window+1)*0x1000]
+	for i := range page {
+		page[i] = 0
+	}
+	if offset < len(m.PRG) {
+		copy(page, m.PRG[offset:])
+	}
+}
+
+func (m *nsfMapper) Save(encoder *gob.Encoder) error {
+	encoder.Encode(m.memory)
+	encoder.Encode(m.banks)
+	encoder.Encode(m.n163RAM)
+	encoder.Encode(m.n163Address)
+	encoder.Encode(m.n163Increase)
+	if m.fds != nil {
+		m.fds.Save(encoder)
+	}
+	if m.n163 != nil {
+		m.n163.Save(encoder)
+	}
+	if m.s5b != nil {
+		m.s5b.Save(encoder)
+	}
+	return nil
+}
+
+func (m *nsfMapper) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&m.memory)
+	decoder.Decode(&m.banks)
+	decoder.Decode(&m.n163RAM)
+	decoder.Decode(&m.n163Address)
+	decoder.Decode(&m.n163Increase)
+	if m.fds != nil {
+		m.fds.Load(decoder)
+	}
+	if m.n163 != nil {
+		m.n163.Load(decoder)
+	}
+	if m.s5b != nil {
+		m.s5b.Load(decoder)
+	}
+	return nil
+}
+
+func (m *nsfMapper) Step() {
+}
+
+func (m *nsfMapper) StepCPU() {
+	if m.fds != nil {
+		m.fds.step()
+	}
+	if m.n163 != nil {
+		m.n163.step(m.n163RAM[:])
+	}
+	if m.s5b != nil {
+		m.s5b.step()
+	}
+}
+
+func (m *nsfMapper) AudioOutput() float32 {
+	var output float32
+	if m.fds != nil {
+		output += m.fds.output()
+	}
+	if m.n163 != nil {
+		output += m.n163.output(m.n163RAM[:])
+	}
+	if m.s5b != nil {
+		output += m.s5b.output()
+	}
+	return output
+}
+
+func (m *nsfMapper) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return m.CHR[address]
+	case address >= 0x6000:
+		return m.memory[address-0x6000]
+	}
+	return 0
+}
+
+func (m *nsfMapper) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		m.CHR[address] = value
+	case m.n163 != nil && address >= 0xF800:
+		m.n163Address = value & 0x7F
+		m.n163Increase = value&0x80 == 0x80
+	case m.s5b != nil && address >= 0xE000:
+		m.s5b.writeData(value)
+	case m.s5b != nil && address >= 0xC000:
+		m.s5b.writeAddress(value)
+	case address < 0x8000 || (m.fds != nil && address < 0xE000):
+		m.memory[address-0x6000] = value
+	}
+}
+
+func (m *nsfMapper) ReadExpansion(address uint16) byte {
+	switch {
+	case address >= nsfDriver && address < nsfDriver+3:
+		driver := [3]byte{0x4C, nsfDriver & 0xFF, nsfDriver >> 8} // JMP nsfDriver
+		return driver[address-nsfDriver]
+	case m.fds != nil && address >= 0x4040 && address < 0x4098:
+		return m.fds.readRegister(address)
+	case m.n163 != nil && address >= 0x4800 && address < 0x5000:
+		value := m.n163RAM[m.n163Address]
+		if m.n163Increase {
+			m.n163Address = (m.n163Address + 1) & 0x7F
+		}
+		return value
+	}
+	return 0
+}
+
+func (m *nsfMapper) WriteExpansion(address uint16, value byte) {
+	switch {
+	case address >= 0x5FF8:
+		if m.nsf.Bankswitched() {
+			m.switchBank(2+int(address-0x5FF8), value)
+		}
+	case address >= 0x5FF6:
+		if m.nsf.Bankswitched() && m.fds != nil {
+			m.switchBank(int(address-0x5FF6), value)
+		}
+	case m.fds != nil && address >= 0x4040 && address < 0x4098:
+		m.fds.writeRegister(address, value)
+	case m.n163 != nil && address >= 0x4800 && address < 0x5000:
+		m.n163RAM[m.n163Address] = value
+		if m.n163Increase {
+			m.n163Address = (m.n163Address + 1) & 0x7F
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Power_Pad
+
+// The order in which the Power Pad buttons, numbered 1-12 as on side B of
+// the mat, are shifted out on bits 3 and 4.
+var (
+	powerPadBit3 = [8]byte{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadBit4 = [4]byte{4, 3, 12, 8}
+)
+
+// PowerPad is the Power Pad or Family Trainer mat, usually plugged into the
+// second port.
+type PowerPad struct {
+	buttons [12]bool
+	index   byte
+	strobe  byte
+}
+
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+func (p *PowerPad) Save(encoder *gob.Encoder) error {
+	encoder.Encode(p.buttons)
+	encoder.Encode(p.index)
+	encoder.Encode(p.strobe)
+	return nil
+}
+
+func (p *PowerPad) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&p.buttons)
+	decoder.Decode(&p.index)
+	decoder.Decode(&p.strobe)
+	return nil
+}
+
+// SetButtons sets the state of buttons 1-12, which are at indexes 0-11.
+func (p *PowerPad) SetButtons(buttons [12]bool) {
+	p.buttons = buttons
+}
+
+func (p *PowerPad) Read() byte {
+	value := byte(0x18)
+	if p.index < 8 && !p.buttons[powerPadBit3[p.index]-1] {
+		value &^= 0x08
+	}
+	if p.index < 4 && !p.buttons[powerPadBit4[p.index]-1] {
+		value &^= 0x10
+	}
+	if p.index < 8 {
+		p.index++
+	}
+	if p.strobe&1 == 1 {
+		p.index = 0
+	}
+	return value
+}
+
+func (p *PowerPad) Write(value byte) {
+	p.strobe = value
+	if p.strobe&1 == 1 {
+		p.index = 0
+	}
+}
@@ -10,9 +10,13 @@ type PPU struct {
 	console *Console // reference to parent object
 
 	Cycle    int    // 0-340
-	ScanLine int    // 0-261, 0-239=visible, 240=post, 241-260=vblank, 261=pre
+	ScanLine int    // 0-261, 0-239=visible, 240=post, 241-260=vblank, 261=pre (NTSC)
 	Frame    uint64 // frame counter
 
+	// fifths of a dot left over from the last CPU step, as PAL runs 3.2
+	// dots per CPU cycle
+	dotFraction int
+
 	// storage variables
 	paletteData   [32]byte
 	nameTableData [2048]byte
@@ -131,6 +135,7 @@ func (ppu *PPU) Save(encoder *gob.Encoder) error {
 	encoder.Encode(ppu.flagSpriteOverflow)
 	encoder.Encode(ppu.oamAddress)
 	encoder.Encode(ppu.bufferedData)
+	encoder.Encode(ppu.dotFraction)
 	return nil
 }
 
@@ -179,6 +184,7 @@ func (ppu *PPU) Load(decoder *gob.Decoder) error {
 	decoder.Decode(&ppu.flagSpriteOverflow)
 	decoder.Decode(&ppu.oamAddress)
 	decoder.Decode(&ppu.bufferedData)
+	decoder.Decode(&ppu.dotFraction)
 	return nil
 }
 
@@ -333,6 +339,10 @@ func (ppu *PPU) writeAddress(value byte) {
 		ppu.t = (ppu.t & 0xFF00) | uint16(value)
 		ppu.v = ppu.t
 		ppu.w = 0
+		// the new address is put on the bus, which mappers can observe
+		if watcher, ok := ppu.console.Mapper.(PPUAddressWatcher); ok {
+			watcher.WatchPPUAddress(ppu.v % 0x4000)
+		}
 	}
 }
 
@@ -640,6 +650,31 @@ func (ppu *PPU) evaluateSprites() {
 		ppu.flagSpriteOverflow = 1
 	}
 	ppu.spriteCount = count
+	ppu.fetchDummySprites(count)
+}
+
+// fetchDummySprites performs the pattern fetches the PPU makes for empty
+// sprite slots. They use tile $FF and are only visible to mappers that watch
+// the PPU address bus, such as the MMC3 scanline counter.
+func (ppu *PPU) fetchDummySprites(count int) {
+	table := ppu.flagSpriteTable
+	if ppu.flagSpriteSize == 1 {
+		table = 1
+	}
+	address := 0x1000*uint16(table) + 0xFF*16
+	for i := count; i < 8; i++ {
+		ppu.Read(address)
+		ppu.Read(address + 8)
+	}
+}
+
+// dots returns the number of PPU cycles that make up the given number of CPU
+// cycles in the console's region.
+func (ppu *PPU) dots(cpuCycles int) int {
+	ppu.dotFraction += cpuCycles * ppu.console.timing().ppuDots
+	dots := ppu.dotFraction / 5
+	ppu.dotFraction %= 5
+	return dots
 }
 
 // tick updates Cycle, ScanLine and Frame counters
@@ -651,8 +686,10 @@ func (ppu *PPU) tick() {
 		}
 	}
 
-	if ppu.flagShowBackground != 0 || ppu.flagShowSprites != 0 {
-		if ppu.f == 1 && ppu.ScanLine == 261 && ppu.Cycle == 339 {
+	timing := ppu.console.timing()
+	preLine := timing.scanLines - 1
+	if timing.skipOddFrame && (ppu.flagShowBackground != 0 || ppu.flagShowSprites != 0) {
+		if ppu.f == 1 && ppu.ScanLine == preLine && ppu.Cycle == 339 {
 			ppu.Cycle = 0
 			ppu.ScanLine = 0
 			ppu.Frame++
@@ -664,7 +701,7 @@ func (ppu *PPU) tick() {
 	if ppu.Cycle > 340 {
 		ppu.Cycle = 0
 		ppu.ScanLine++
-		if ppu.ScanLine > 261 {
+		if ppu.ScanLine > preLine {
 			ppu.ScanLine = 0
 			ppu.Frame++
 			ppu.f ^= 1
@@ -676,8 +713,9 @@ func (ppu *PPU) tick() {
 func (ppu *PPU) Step() {
 	ppu.tick()
 
+	timing := ppu.console.timing()
 	renderingEnabled := ppu.flagShowBackground != 0 || ppu.flagShowSprites != 0
-	preLine := ppu.ScanLine == 261
+	preLine := ppu.ScanLine == timing.scanLines-1
 	visibleLine := ppu.ScanLine < 240
 	// postLine := ppu.ScanLine == 240
 	renderLine := preLine || visibleLine
@@ -729,11 +767,14 @@ func (ppu *PPU) Step() {
 			} else {
 				ppu.spriteCount = 0
 			}
+			if preLine {
+				ppu.fetchDummySprites(0)
+			}
 		}
 	}
 
 	// vblank logic
-	if ppu.ScanLine == 241 && ppu.Cycle == 1 {
+	if ppu.ScanLine == timing.vblankLine && ppu.Cycle == 1 {
 		ppu.setVerticalBlank()
 	}
 	if preLine && ppu.Cycle == 1 {
@@ -0,0 +1,74 @@
+package nes
+
+// Region selects the timing of the console: the CPU clock, the number of
+// scanlines per frame and the APU rate tables.
+// https://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+type Region byte
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+	RegionDendy
+)
+
+func (region Region) String() string {
+	switch region {
+	case RegionPAL:
+		return "PAL"
+	case RegionDendy:
+		return "Dendy"
+	}
+	return "NTSC"
+}
+
+type regionTiming struct {
+	cpuFrequency     float64  // CPU cycles per second
+	ppuDots          int      // PPU dots per 5 CPU cycles
+	scanLines        int      // scanlines per frame, including pre-render
+	vblankLine       int      // scanline on which vertical blank starts
+	skipOddFrame     bool     // odd frames skip a dot when rendering
+	frameCounterRate float64  // CPU cycles per frame counter step
+	noiseTable       []uint16 // noise timer periods
+	dmcTable         []byte   // DMC timer periods
+}
+
+var regionTimings = [...]regionTiming{
+	RegionNTSC: {
+		cpuFrequency:     CPUFrequency,
+		ppuDots:          15,
+		scanLines:        262,
+		vblankLine:       241,
+		skipOddFrame:     true,
+		frameCounterRate: frameCounterRate,
+		noiseTable:       noiseTable,
+		dmcTable:         dmcTable,
+	},
+	RegionPAL: {
+		cpuFrequency:     1662607,
+		ppuDots:          16,
+		scanLines:        312,
+		vblankLine:       241,
+		frameCounterRate: 1662607 / 200.0,
+		noiseTable:       noiseTablePAL,
+		dmcTable:         dmcTablePAL,
+	},
+	RegionDendy: {
+		// Dendy clones have PAL frame timing, but keep the NTSC APU and PPU
+		// clock ratio and delay vblank so NTSC games run unmodified
+		cpuFrequency:     1773448,
+		ppuDots:          15,
+		scanLines:        312,
+		vblankLine:       291,
+		frameCounterRate: frameCounterRate,
+		noiseTable:       noiseTable,
+		dmcTable:         dmcTable,
+	},
+}
+
+var noiseTablePAL = []uint16{
+	4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778,
+}
+
+var dmcTablePAL = []byte{
+	199, 177, 158, 149, 138, 118, 105, 99, 88, 74, 66, 59, 49, 39, 33, 25,
+}
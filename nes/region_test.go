@@ -0,0 +1,52 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegionFrameTiming(t *testing.T) {
+	// NROM filled with NOPs, with rendering left disabled
+	prg := bytes.Repeat([]byte{0xEA}, 0x4000)
+	tests := []struct {
+		region Region
+		cycles float64
+	}{
+		{RegionNTSC, 262 * 341 / 3.0},
+		{RegionPAL, 312 * 341 / 3.2},
+		{RegionDendy, 312 * 341 / 3.0},
+	}
+	for _, test := range tests {
+		cartridge := NewCartridge(prg, make([]byte, 0x2000), 0, MirrorHorizontal, 0)
+		console, err := NewConsoleFromCartridge(cartridge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		console.SetRegion(test.region)
+		console.Reset()
+		console.StepFrame()
+		cycles := 0
+		for i := 0; i < 10; i++ {
+			cycles += console.StepFrame()
+		}
+		if got := float64(cycles) / 10; got < test.cycles-2 || got > test.cycles+2 {
+			t.Errorf("%s: expected %.1f CPU cycles per frame, got %.1f", test.region, test.cycles, got)
+		}
+		if got := console.CPUFrequency() / console.FrameRate(); got < test.cycles-2 || got > test.cycles+2 {
+			t.Errorf("%s: expected a frame rate of %.1f cycles per frame, got %.1f", test.region, test.cycles, got)
+		}
+	}
+}
+
+func TestLoadNESRegion(t *testing.T) {
+	data := testNESImage(0, 0)
+	data[7] |= 0x08 // NES 2.0
+	data[12] = 1
+	cartridge, err := LoadNES(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.Region != RegionPAL {
+		t.Fatalf("expected PAL region, got %s", cartridge.Region)
+	}
+}
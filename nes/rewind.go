@@ -0,0 +1,178 @@
+package nes
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+)
+
+// snapshots per keyframe; the others are stored as deltas against it
+const rewindKeyframeInterval = 30
+
+// rewindGroup is a keyframe and the snapshots taken after it. Each snapshot
+// is stored compressed, and the deltas are XORed with the keyframe first so
+// that the parts of the state that did not change compress to almost
+// nothing.
+type rewindGroup struct {
+	keyframe []byte
+	deltas   [][]byte
+	frames   []uint64 // frame of the keyframe followed by those of the deltas
+	size     int
+}
+
+// rewindBuffer keeps a bounded history of dynamic state snapshots taken
+// every interval frames. When the compressed snapshots exceed limit bytes,
+// the oldest keyframe is dropped along with its deltas.
+type rewindBuffer struct {
+	interval int
+	limit    int
+	groups   []*rewindGroup
+	key      []byte // uncompressed keyframe of the last group
+	frame    uint64 // frame of the last snapshot, or of the restored state
+	size     int
+}
+
+// SetRewind keeps a snapshot of the console every interval frames, using up
+// to limit bytes of memory. A limit of zero turns rewinding off.
+func (console *Console) SetRewind(interval, limit int) {
+	if interval < 1 {
+		interval = 1
+	}
+	if limit <= 0 {
+		console.rewind = nil
+		return
+	}
+	console.rewind = &rewindBuffer{interval: interval, limit: limit}
+	console.rewind.snapshot(console)
+}
+
+// Rewind restores the most recent snapshot from before the current frame
+// and removes it from the buffer. The oldest snapshot is kept, and Rewind
+// returns false once the console is back at it.
+func (console *Console) Rewind() bool {
+	r := console.rewind
+	if r == nil || len(r.groups) == 0 {
+		return false
+	}
+	// a snapshot of the current frame would not go back at all
+	for !r.oldest() && r.lastFrame() >= console.PPU.Frame {
+		r.pop()
+	}
+	var data []byte
+	if r.oldest() {
+		if r.lastFrame() >= console.PPU.Frame {
+			return false
+		}
+		data = r.key
+	} else {
+		data = r.pop()
+	}
+	if err := console.DeserializeDynamic(data); err != nil {
+		return false
+	}
+	r.frame = console.PPU.Frame
+	return true
+}
+
+// step takes a snapshot when interval frames have passed since the last one.
+// Loading a state can move the frame counter back, which also starts a new
+// snapshot.
+func (r *rewindBuffer) step(console *Console) {
+	frame := console.PPU.Frame
+	if frame >= r.frame && frame-r.frame < uint64(r.interval) {
+		return
+	}
+	r.snapshot(console)
+}
+
+func (r *rewindBuffer) snapshot(console *Console) {
+	data, err := console.SerializeDynamic()
+	if err != nil {
+		return
+	}
+	r.frame = console.PPU.Frame
+	last := r.last()
+	if last == nil || len(last.deltas) >= rewindKeyframeInterval-1 {
+		group := &rewindGroup{keyframe: compress(data), frames: []uint64{r.frame}}
+		group.size = len(group.keyframe)
+		r.groups = append(r.groups, group)
+		r.key = data
+		r.size += group.size
+	} else {
+		delta := compress(xorBytes(data, r.key))
+		last.deltas = append(last.deltas, delta)
+		last.frames = append(last.frames, r.frame)
+		last.size += len(delta)
+		r.size += len(delta)
+	}
+	// drop the oldest groups, but never the one being added to
+	for r.size > r.limit && len(r.groups) > 1 {
+		r.size -= r.groups[0].size
+		r.groups[0] = nil
+		r.groups = r.groups[1:]
+	}
+}
+
+// pop removes the most recent snapshot and returns it uncompressed. It must
+// not be called on the oldest snapshot.
+func (r *rewindBuffer) pop() []byte {
+	last := r.last()
+	if n := len(last.deltas); n > 0 {
+		delta := last.deltas[n-1]
+		last.deltas = last.deltas[:n-1]
+		last.frames = last.frames[:n]
+		last.size -= len(delta)
+		r.size -= len(delta)
+		return xorBytes(decompress(delta), r.key)
+	}
+	data := r.key
+	r.size -= last.size
+	r.groups = r.groups[:len(r.groups)-1]
+	r.key = decompress(r.last().keyframe)
+	return data
+}
+
+// oldest reports whether only the oldest snapshot is left.
+func (r *rewindBuffer) oldest() bool {
+	return len(r.groups) == 1 && len(r.groups[0].deltas) == 0
+}
+
+func (r *rewindBuffer) lastFrame() uint64 {
+	frames := r.last().frames
+	return frames[len(frames)-1]
+}
+
+func (r *rewindBuffer) last() *rewindGroup {
+	if len(r.groups) == 0 {
+		return nil
+	}
+	return r.groups[len(r.groups)-1]
+}
+
+// xorBytes returns a XOR b, as long as a. Missing bytes of b count as zero,
+// so that states of different lengths can be diffed.
+func xorBytes(a, b []byte) []byte {
+	result := make([]byte, len(a))
+	copy(result, a)
+	n := len(b)
+	if n > len(a) {
+		n = len(a)
+	}
+	for i := 0; i < n; i++ {
+		result[i] ^= b[i]
+	}
+	return result
+}
+
+func compress(data []byte) []byte {
+	var buffer bytes.Buffer
+	writer, _ := flate.NewWriter(&buffer, flate.BestSpeed)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func decompress(data []byte) []byte {
+	result, _ := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	return result
+}
@@ -0,0 +1,54 @@
+package nes
+
+import "testing"
+
+func TestRewind(t *testing.T) {
+	console := newTestConsole(t)
+	console.Reset()
+	console.SetRewind(2, 1<<20)
+	for i := 0; i < 100; i++ {
+		console.RAM[0] = byte(i)
+		console.StepFrame()
+	}
+	frame := console.PPU.Frame
+	if !console.Rewind() {
+		t.Fatal("expected to rewind")
+	}
+	if console.PPU.Frame >= frame || console.PPU.Frame+2 < frame {
+		t.Fatalf("expected to go back at most 2 frames from %d, got %d", frame, console.PPU.Frame)
+	}
+	// the snapshot was taken when the frame ended, after RAM was written
+	if want := byte(console.PPU.Frame - 1); console.RAM[0] != want {
+		t.Fatalf("expected RAM value %d, got %d", want, console.RAM[0])
+	}
+	count := 1
+	for console.Rewind() {
+		count++
+	}
+	if count != 50 || console.RAM[0] != 0 {
+		t.Fatalf("expected to rewind 50 times to the start, got %d and RAM value %d", count, console.RAM[0])
+	}
+}
+
+func TestRewindLimit(t *testing.T) {
+	console := newTestConsole(t)
+	console.Reset()
+	console.SetRewind(1, 4096)
+	for i := 0; i < 200; i++ {
+		for j := range console.RAM {
+			console.RAM[j] = byte(i * j)
+		}
+		console.StepFrame()
+	}
+	r := console.rewind
+	if len(r.groups) > 1 && r.size > r.limit {
+		t.Fatalf("expected at most %d bytes, got %d", r.limit, r.size)
+	}
+	count := 0
+	for console.Rewind() {
+		count++
+	}
+	if count == 0 || count >= 200 {
+		t.Fatalf("expected a bounded number of snapshots, got %d", count)
+	}
+}
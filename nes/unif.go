@@ -0,0 +1,190 @@
+package nes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const unifFileMagic = "UNIF"
+
+type unifFileHeader struct {
+	Magic    [4]byte  // UNIF magic
+	Revision uint32   // format revision
+	_        [24]byte // unused padding
+}
+
+type unifChunkHeader struct {
+	ID     [4]byte
+	Length uint32
+}
+
+// unifBoards maps UNIF board names, without their NES-, UNL-, HVC-, BTL- or
+// BMC- prefix, to mapper and submapper numbers.
+var unifBoards = map[string][2]byte{
+	"NROM":     {0, 0},
+	"NROM-128": {0, 0},
+	"NROM-256": {0, 0},
+	"RROM":     {0, 0},
+	"RROM-128": {0, 0},
+	"SAROM":    {1, 0},
+	"SBROM":    {1, 0},
+	"SCROM":    {1, 0},
+	"SEROM":    {1, 0},
+	"SGROM":    {1, 0},
+	"SKROM":    {1, 0},
+	"SLROM":    {1, 0},
+	"SL1ROM":   {1, 0},
+	"SNROM":    {1, 0},
+	"SOROM":    {1, 0},
+	"UNROM":    {2, 0},
+	"UOROM":    {2, 0},
+	"CNROM":    {3, 0},
+	"TBROM":    {4, 0},
+	"TEROM":    {4, 0},
+	"TFROM":    {4, 0},
+	"TGROM":    {4, 0},
+	"TKROM":    {4, 0},
+	"TLROM":    {4, 0},
+	"TR1ROM":   {4, 0},
+	"TSROM":    {4, 0},
+	"TVROM":    {4, 0},
+	"AMROM":    {7, 0},
+	"ANROM":    {7, 0},
+	"AOROM":    {7, 0},
+	"PNROM":    {9, 0},
+	"PEEOROM":  {9, 0},
+	"FJROM":    {10, 0},
+	"FKROM":    {10, 0},
+	"BNROM":    {34, 2},
+	"NINA-001": {34, 1},
+	"NINA-03":  {79, 0},
+	"NINA-06":  {79, 0},
+	"GNROM":    {66, 0},
+	"MHROM":    {66, 0},
+	"JLROM":    {69, 0},
+	"JSROM":    {69, 0},
+	"DEROM":    {206, 0},
+	"DE1ROM":   {206, 0},
+	"DRROM":    {206, 0},
+}
+
+// LoadUNIFFile reads a UNIF file (.unf) and returns a Cartridge on success.
+// Only boards that map to an implemented mapper are supported.
+// https://wiki.nesdev.com/w/index.php/UNIF
+func LoadUNIFFile(path string) (*Cartridge, error) {
+	// open file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadUNIF(file)
+}
+
+// LoadUNIF reads a UNIF image from r and returns a Cartridge on success.
+func LoadUNIF(file io.Reader) (*Cartridge, error) {
+	// read file header
+	header := unifFileHeader{}
+	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	// verify header magic number
+	if string(header.Magic[:]) != unifFileMagic {
+		return nil, errors.New("invalid .unf file")
+	}
+
+	// read chunks
+	var board string
+	var prgChunks, chrChunks [16][]byte
+	var mirror, battery byte
+	for {
+		chunk := unifChunkHeader{}
+		if err := binary.Read(file, binary.LittleEndian, &chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// the length is not trusted until the data has been read, so that a
+		// short file cannot make us allocate gigabytes
+		data, err := ioutil.ReadAll(io.LimitReader(file, int64(chunk.Length)))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != int(chunk.Length) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		id := string(chunk.ID[:])
+		switch {
+		case id == "MAPR":
+			board = strings.TrimRight(string(data), "\x00")
+		case strings.HasPrefix(id, "PRG"):
+			if index, ok := unifChunkIndex(id); ok {
+				prgChunks[index] = data
+			}
+		case strings.HasPrefix(id, "CHR"):
+			if index, ok := unifChunkIndex(id); ok {
+				chrChunks[index] = data
+			}
+		case id == "MIRR" && len(data) > 0:
+			// 5 means mapper controlled, which starts out horizontal
+			if data[0] <= MirrorFour {
+				mirror = data[0]
+			}
+		case id == "BATR":
+			battery = 1
+		}
+	}
+
+	// look up board
+	mapper, ok := unifBoard(board)
+	if !ok {
+		return nil, fmt.Errorf("unsupported UNIF board: %s", board)
+	}
+
+	// concatenate rom chunks
+	var prg, chr []byte
+	for i := range prgChunks {
+		prg = append(prg, prgChunks[i]...)
+		chr = append(chr, chrChunks[i]...)
+	}
+	if len(prg) == 0 {
+		return nil, errors.New("invalid .unf file: no PRG data")
+	}
+
+	// provide chr-rom/ram if not in file
+	if len(chr) == 0 {
+		chr = make([]byte, 8192)
+	}
+
+	// success
+	cartridge := NewCartridge(prg, chr, mapper[0], mirror, battery)
+	cartridge.SubMapper = mapper[1]
+	return cartridge, nil
+}
+
+// unifChunkIndex parses the hex digit at the end of a PRGn or CHRn chunk ID.
+func unifChunkIndex(id string) (int, bool) {
+	c := id[3]
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+func unifBoard(name string) ([2]byte, bool) {
+	name = strings.ToUpper(name)
+	for _, prefix := range []string{"NES-", "UNL-", "HVC-", "BTL-", "BMC-", "AVE-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	mapper, ok := unifBoards[name]
+	return mapper, ok
+}
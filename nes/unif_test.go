@@ -0,0 +1,66 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeUNIFChunk(buffer *bytes.Buffer, id string, data []byte) {
+	buffer.WriteString(id)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(data)))
+	buffer.Write(data)
+}
+
+func TestLoadUNIFFile(t *testing.T) {
+	var buffer bytes.Buffer
+	buffer.WriteString(unifFileMagic)
+	binary.Write(&buffer, binary.LittleEndian, uint32(7))
+	buffer.Write(make([]byte, 24))
+	writeUNIFChunk(&buffer, "MAPR", []byte("NES-UOROM\x00"))
+	writeUNIFChunk(&buffer, "PRG1", bytes.Repeat([]byte{1}, 0x4000))
+	writeUNIFChunk(&buffer, "PRG0", bytes.Repeat([]byte{0}, 0x4000))
+	writeUNIFChunk(&buffer, "MIRR", []byte{1})
+	writeUNIFChunk(&buffer, "BATR", []byte{1})
+
+	file, err := ioutil.TempFile("", "unif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(buffer.Bytes())
+	file.Close()
+
+	cartridge, err := LoadUNIFFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.Mapper != 2 || cartridge.Mirror != MirrorVertical || cartridge.Battery != 1 {
+		t.Fatalf("unexpected cartridge: mapper %d mirror %d battery %d",
+			cartridge.Mapper, cartridge.Mirror, cartridge.Battery)
+	}
+	// PRG chunks are concatenated in chunk number order
+	if len(cartridge.PRG) != 0x8000 || cartridge.PRG[0] != 0 || cartridge.PRG[0x4000] != 1 {
+		t.Fatalf("expected PRG0 followed by PRG1")
+	}
+	if len(cartridge.CHR) != 0x2000 {
+		t.Fatalf("expected 8KB of CHR-RAM, got %d bytes", len(cartridge.CHR))
+	}
+}
+
+func TestLoadUNIFTruncated(t *testing.T) {
+	// a chunk claiming 4GB in a file of a few bytes
+	var buffer bytes.Buffer
+	buffer.WriteString(unifFileMagic)
+	binary.Write(&buffer, binary.LittleEndian, uint32(7))
+	buffer.Write(make([]byte, 24))
+	buffer.WriteString("PRG0")
+	binary.Write(&buffer, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buffer.Write(make([]byte, 16))
+	if _, err := LoadUNIF(&buffer); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected a truncated chunk, got %v", err)
+	}
+}
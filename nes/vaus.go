@@ -0,0 +1,79 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Arkanoid_controller
+
+// The range of positions reported by the NES Arkanoid controller.
+const (
+	VausMin = 98
+	VausMax = 242
+)
+
+// Vaus is the Arkanoid paddle controller, usually plugged into the second
+// port. The position of its knob is latched by the strobe and shifted out
+// on bit 4, inverted and most significant bit first. Bit 3 is the button.
+type Vaus struct {
+	position byte
+	button   bool
+	shift    byte
+	strobe   byte
+}
+
+func NewVaus() *Vaus {
+	return &Vaus{position: (VausMin + VausMax) / 2}
+}
+
+func (v *Vaus) Save(encoder *gob.Encoder) error {
+	encoder.Encode(v.position)
+	encoder.Encode(v.button)
+	encoder.Encode(v.shift)
+	encoder.Encode(v.strobe)
+	return nil
+}
+
+func (v *Vaus) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&v.position)
+	decoder.Decode(&v.button)
+	decoder.Decode(&v.shift)
+	decoder.Decode(&v.strobe)
+	return nil
+}
+
+// SetPosition turns the knob. Positions are clamped to VausMin-VausMax.
+func (v *Vaus) SetPosition(position int) {
+	if position < VausMin {
+		position = VausMin
+	}
+	if position > VausMax {
+		position = VausMax
+	}
+	v.position = byte(position)
+}
+
+func (v *Vaus) SetButton(pressed bool) {
+	v.button = pressed
+}
+
+func (v *Vaus) Read() byte {
+	var value byte
+	if v.button {
+		value |= 0x08
+	}
+	if v.shift&0x80 == 0 {
+		value |= 0x10
+	}
+	if v.strobe&1 == 1 {
+		v.shift = v.position
+	} else {
+		v.shift <<= 1
+	}
+	return value
+}
+
+func (v *Vaus) Write(value byte) {
+	v.strobe = value
+	if v.strobe&1 == 1 {
+		v.shift = v.position
+	}
+}
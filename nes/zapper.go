@@ -0,0 +1,90 @@
+package nes
+
+import "encoding/gob"
+
+// https://wiki.nesdev.com/w/index.php/Zapper
+
+const (
+	zapperRadius     = 2   // pixels around the aim point seen by the sensor
+	zapperLightLines = 26  // scanlines the sensor stays lit after the beam
+	zapperBrightness = 600 // minimum R+G+B for a pixel to count as light
+)
+
+// Zapper is the light gun. It is usually plugged into the second port.
+type Zapper struct {
+	console *Console
+	x, y    int
+	trigger bool
+}
+
+func NewZapper(console *Console) *Zapper {
+	return &Zapper{console: console, x: -1, y: -1}
+}
+
+func (z *Zapper) Save(encoder *gob.Encoder) error {
+	encoder.Encode(z.x)
+	encoder.Encode(z.y)
+	encoder.Encode(z.trigger)
+	return nil
+}
+
+func (z *Zapper) Load(decoder *gob.Decoder) error {
+	decoder.Decode(&z.x)
+	decoder.Decode(&z.y)
+	decoder.Decode(&z.trigger)
+	return nil
+}
+
+// Aim points the gun at a pixel of the screen. Coordinates outside the
+// screen point the gun away from it.
+func (z *Zapper) Aim(x, y int) {
+	z.x = x
+	z.y = y
+}
+
+func (z *Zapper) SetTrigger(pulled bool) {
+	z.trigger = pulled
+}
+
+// Read returns the light sensor in bit 3, which is clear when light is
+// detected, and the trigger in bit 4.
+func (z *Zapper) Read() byte {
+	var value byte
+	if !z.light() {
+		value |= 0x08
+	}
+	if z.trigger {
+		value |= 0x10
+	}
+	return value
+}
+
+func (z *Zapper) Write(value byte) {
+}
+
+// light reports whether the sensor sees a bright pixel near the aim point
+// that the PPU has drawn within the last few scanlines.
+func (z *Zapper) light() bool {
+	ppu := z.console.PPU
+	if z.x < 0 || z.x >= 256 || z.y < 0 || z.y >= 240 || ppu.ScanLine >= 240 {
+		return false
+	}
+	if ppu.ScanLine < z.y-zapperRadius || ppu.ScanLine > z.y+zapperLightLines {
+		return false
+	}
+	for y := z.y - zapperRadius; y <= z.y+zapperRadius; y++ {
+		if y < 0 || y >= 240 || y > ppu.ScanLine {
+			continue
+		}
+		for x := z.x - zapperRadius; x <= z.x+zapperRadius; x++ {
+			if x < 0 || x >= 256 || (y == ppu.ScanLine && x >= ppu.Cycle) {
+				continue
+			}
+			c := ppu.back.RGBAAt(x, y)
+			if int(c.R)+int(c.G)+int(c.B) >= zapperBrightness {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package nes
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestZapper(t *testing.T) {
+	console := newTestConsole(t)
+	zapper := NewZapper(console)
+	console.Port2 = zapper
+	ppu := console.PPU
+	ppu.back.SetRGBA(100, 50, color.RGBA{255, 255, 255, 255})
+
+	zapper.Aim(100, 50)
+	zapper.SetTrigger(true)
+	tests := []struct {
+		scanLine, cycle int
+		value           byte
+	}{
+		{50, 100, 0x18}, // not drawn yet
+		{50, 101, 0x10},
+		{60, 0, 0x10},
+		{50 + zapperLightLines + 1, 0, 0x18}, // sensor has gone dark
+		{241, 0, 0x18},
+	}
+	for _, test := range tests {
+		ppu.ScanLine, ppu.Cycle = test.scanLine, test.cycle
+		if value := console.CPU.Read(0x4017); value != test.value {
+			t.Errorf("scanline %d cycle %d: expected $%02X, got $%02X",
+				test.scanLine, test.cycle, test.value, value)
+		}
+	}
+
+	zapper.Aim(-1, -1)
+	zapper.SetTrigger(false)
+	ppu.ScanLine = 60
+	if value := console.CPU.Read(0x4017); value != 0x08 {
+		t.Errorf("expected no light when aimed off screen, got $%02X", value)
+	}
+}
@@ -0,0 +1,160 @@
+// Package preimage stores console state preimages on disk, named by the
+// Keccak-256 hash of their contents.
+package preimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrHashMismatch is returned when data does not hash to the hash it is
+// stored or requested under.
+var ErrHashMismatch = errors.New("preimage does not match its hash")
+
+// gzipExt is the extension of compressed preimages.
+const gzipExt = ".gz"
+
+// Store is a directory of preimages. Each one is a file named by the hex
+// hash of its contents, as served to the browser from static/preimages.
+// Compressed preimages have a .gz extension. Both kinds are read, whichever
+// kind the store writes.
+type Store struct {
+	dir      string
+	compress bool
+}
+
+// NewStore returns a store in dir, which is created when the first preimage
+// is written. If compress is set, new preimages are gzipped.
+func NewStore(dir string, compress bool) *Store {
+	return &Store{dir, compress}
+}
+
+// Hash returns the hash that data is stored under.
+func Hash(data []byte) common.Hash {
+	return crypto.Keccak256Hash(data)
+}
+
+// ParseHash parses a hash written as 0x and 64 hex digits, as preimage files
+// are named.
+func ParseHash(s string) (common.Hash, error) {
+	if len(s) != 2+2*common.HashLength || !strings.HasPrefix(s, "0x") {
+		return common.Hash{}, errors.New("invalid hash: " + s)
+	}
+	data, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return common.Hash{}, errors.New("invalid hash: " + s)
+	}
+	return common.BytesToHash(data), nil
+}
+
+// Add stores data and returns its hash.
+func (s *Store) Add(data []byte) (common.Hash, error) {
+	hash := Hash(data)
+	return hash, s.Put(hash, data)
+}
+
+// Put stores data under hash, which must be its hash. Data that is already
+// in the store is not written again.
+func (s *Store) Put(hash common.Hash, data []byte) error {
+	if Hash(data) != hash {
+		return ErrHashMismatch
+	}
+	if s.Has(hash) {
+		return nil
+	}
+	filename := s.path(hash)
+	if s.compress {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(data)
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		data = buffer.Bytes()
+		filename += gzipExt
+	}
+	return writeFile(filename, data)
+}
+
+// Get returns the preimage of hash. It returns an error satisfying
+// os.IsNotExist if the store does not have it, and ErrHashMismatch if the
+// file has been corrupted.
+func (s *Store) Get(hash common.Hash) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(hash))
+	if os.IsNotExist(err) {
+		data, err = readGzipFile(s.path(hash) + gzipExt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if Hash(data) != hash {
+		return nil, ErrHashMismatch
+	}
+	return data, nil
+}
+
+// Has reports whether the store has a file for hash. The file is not
+// verified.
+func (s *Store) Has(hash common.Hash) bool {
+	for _, filename := range []string{s.path(hash), s.path(hash) + gzipExt} {
+		if _, err := os.Stat(filename); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) path(hash common.Hash) string {
+	return path.Join(s.dir, hash.Hex())
+}
+
+func readGzipFile(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// writeFile writes data to a temporary file and renames it into place, so
+// that readers never see a partly written preimage.
+func writeFile(filename string, data []byte) error {
+	dir, _ := path.Split(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(dir, ".preimage")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
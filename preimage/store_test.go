@@ -0,0 +1,64 @@
+package preimage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preimage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, compress := range []bool{false, true} {
+		store := NewStore(path.Join(dir, "store"), compress)
+		data := []byte{byte(len(dir)), 1, 2, 3}
+		if compress {
+			data = append(data, 4)
+		}
+		hash := Hash(data)
+		if _, err := store.Get(hash); !os.IsNotExist(err) {
+			t.Fatalf("expected a missing preimage, got %v", err)
+		}
+		if err := store.Put(hash, data[1:]); err != ErrHashMismatch {
+			t.Fatalf("expected a hash mismatch, got %v", err)
+		}
+		if _, err := store.Add(data); err != nil {
+			t.Fatal(err)
+		}
+		if !store.Has(hash) {
+			t.Fatal("expected the store to have the preimage")
+		}
+		// both kinds of file can be read by either store
+		other := NewStore(path.Join(dir, "store"), !compress)
+		result, err := other.Get(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != string(data) {
+			t.Fatalf("expected %v, got %v", data, result)
+		}
+	}
+}
+
+func TestStoreCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preimage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewStore(dir, false)
+	hash, err := store.Add([]byte("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, hash.Hex()), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(hash); err != ErrHashMismatch {
+		t.Fatalf("expected a hash mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Plays the samples that the WASM build writes into a SharedArrayBuffer: the
+// read and write indexes as two int32s, followed by a ring of float32
+// samples. The ring is empty when the indexes are equal, and this side only
+// moves the read index.
+class NesAudioProcessor extends AudioWorkletProcessor {
+    constructor(options) {
+        super();
+        const buffer = options.processorOptions.buffer;
+        this.indexes = new Int32Array(buffer, 0, 2);
+        this.ring = new Float32Array(buffer, 8);
+        this.last = 0;
+    }
+
+    process(inputs, outputs) {
+        const output = outputs[0];
+        const samples = output[0];
+        let read = Atomics.load(this.indexes, 0);
+        const write = Atomics.load(this.indexes, 1);
+        for (let i = 0; i < samples.length; i++) {
+            if (read !== write) {
+                this.last = this.ring[read];
+                read = (read + 1) % this.ring.length;
+            } else {
+                // out of samples: fade out instead of clicking
+                this.last *= 0.99;
+            }
+            samples[i] = this.last;
+        }
+        Atomics.store(this.indexes, 0, read);
+        for (let channel = 1; channel < output.length; channel++) {
+            output[channel].set(samples);
+        }
+        return true;
+    }
+}
+
+registerProcessor("nes-audio", NesAudioProcessor);
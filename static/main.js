@@ -1,5 +1,5 @@
-const staticHash = "0xda2437bb81b1a07d5e2832768ba41f1a43cf060ba5a2db3ac0265361220ed82c"
-const dynHash = "0x4123f2d81428f7090218f975b941122f3797aeb8f97bf7d1ef6e87491c920a5c"
+const staticHash = "0x62ebaf62339a1e9d5a1300490e3d4ba940be95f029b449a6e8ba8282aca10a8d"
+const dynHash = "0x0685196a3bad02183605a8d69ac48cad16416a48f4991b7358fc36305a04a4fa"
 
 function hexToUint8Array(hexString) {
     if (hexString.length % 2 !== 0) {
@@ -16,6 +16,16 @@ function hexToUint8Array(hexString) {
     return bytes;
 }
 
+// uint8ArrayToBase64 encodes bytes the way Go's encoding/json expects a
+// []byte, in chunks, as states are too large to spread into one call.
+function uint8ArrayToBase64(bytes) {
+    let binary = "";
+    for (let i = 0; i < bytes.length; i += 0x8000) {
+        binary += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+    }
+    return btoa(binary);
+}
+
 async function fetchPreimage(hashStr) {
     const resp = await fetch(`/preimages/${hashStr}`);
     const buffer = await resp.arrayBuffer();
@@ -26,6 +36,42 @@ async function fetchPreimage(hashStr) {
 const staticHashBytes = hexToUint8Array(staticHash);
 const dynHashBytes = hexToUint8Array(dynHash);
 
+// plays the console's audio through an AudioWorklet, which reads the samples
+// from a ring buffer shared with the WASM build. Sharing memory needs a
+// cross-origin isolated page, which cmd/serve sets up.
+async function startAudio(api) {
+    if (!window.crossOriginIsolated || !window.AudioWorkletNode) {
+        throw new Error("the page is not cross-origin isolated");
+    }
+    const context = new AudioContext();
+    await context.audioWorklet.addModule("audio.js");
+    // a quarter of a second of samples after the two indexes
+    const buffer = new SharedArrayBuffer(8 + 4 * Math.ceil(context.sampleRate / 4));
+    const node = new AudioWorkletNode(context, "nes-audio", {
+        numberOfInputs: 0,
+        outputChannelCount: [1],
+        processorOptions: { buffer },
+    });
+    node.connect(context.destination);
+    api.setAudio(buffer, context.sampleRate);
+
+    // browsers only start audio after the user interacts with the page
+    const resume = () => {
+        if (context.state === "suspended") {
+            context.resume();
+        }
+    };
+    window.addEventListener("keydown", resume);
+    window.addEventListener("pointerdown", resume);
+
+    let muted = false;
+    window.setMuted = (value) => {
+        muted = !!value;
+        api.setMuted(muted);
+    };
+    window.toggleMute = () => window.setMuted(!muted);
+}
+
 if (WebAssembly) {
     if (WebAssembly && !WebAssembly.instantiateStreaming) { // polyfill
         WebAssembly.instantiateStreaming = async (resp, importObject) => {
@@ -40,18 +86,79 @@ if (WebAssembly) {
         const api = window.NesAPI();
         console.log("NesAPI loaded", api);
 
-        api.setPreimage(staticHashBytes, await fetchPreimage(staticHash));
-        api.setPreimage(dynHashBytes, await fetchPreimage(dynHash));
+        if (!api.setPreimage(staticHashBytes, await fetchPreimage(staticHash))) {
+            console.error("Static preimage does not match its hash", staticHash);
+        }
+        if (!api.setPreimage(dynHashBytes, await fetchPreimage(dynHash))) {
+            console.error("Dynamic preimage does not match its hash", dynHash);
+        }
 
         api.start();
         api.setCartridge(staticHashBytes, dynHashBytes);
 
+        startAudio(api).catch((err) => {
+            console.error("Audio is not available", err);
+        });
+
+        // the first four gamepads drive the four controllers, the last two
+        // through a four player adapter (NesAPI().setFourPlayer), using the
+        // standard mapping: A, B, Select, Start, then the d-pad
+        const padButtons = [0, 2, 8, 9, 12, 13, 14, 15];
+        const padStates = [[], [], [], []];
+        const pollGamepads = () => {
+            const gamepads = navigator.getGamepads ? navigator.getGamepads() : [];
+            for (let port = 0; port < 4; port++) {
+                const gamepad = gamepads[port];
+                padButtons.forEach((index, button) => {
+                    const pressed = !!(gamepad && gamepad.buttons[index] && gamepad.buttons[index].pressed);
+                    if (pressed !== !!padStates[port][button]) {
+                        padStates[port][button] = pressed;
+                        api.setButton(port, button, pressed);
+                    }
+                });
+            }
+            requestAnimationFrame(pollGamepads);
+        };
+        requestAnimationFrame(pollGamepads);
+
         setInterval(() => {
             const activity = api.getActivity();
             const jsonString = new TextDecoder().decode(activity);
             const jsonObject = JSON.parse(jsonString);
             console.log("Activity", jsonObject);
         }, 10000);
+
+        // the zapper is plugged into the second port from then on, aimed with
+        // the mouse
+        window.plugZapper = () => api.plugZapper();
+
+        // posts the session so far to cmd/serve, which replays it to verify it
+        window.submitSession = async () => {
+            const activity = JSON.parse(new TextDecoder().decode(api.getActivity()));
+            const session = {
+                static: activity.Static,
+                start: activity.Start,
+                end: activity.Hash,
+                activity: activity.Activity,
+            };
+            if (activity.Static !== staticHash) {
+                // a rom loaded with setROM: the server does not have its
+                // states, so they are sent along, base64 encoded
+                session.preimages = [activity.Static, activity.Start].map((hash) => {
+                    return uint8ArrayToBase64(api.getPreimage(hexToUint8Array(hash)));
+                });
+            }
+            const resp = await fetch("/sessions", {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(session),
+            });
+            if (!resp.ok) {
+                console.error("Session rejected", await resp.text());
+                return;
+            }
+            console.log("Session accepted", await resp.json());
+        };
     }).catch((err) => {
         console.error(err);
     });
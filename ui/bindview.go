@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strings"
+
+	"github.com/fogleman/nes/input"
+	"github.com/go-gl/gl/v2.1/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+)
+
+// BindingsView asks for a key or joystick input for each action in turn and
+// saves the result to the bindings file.
+type BindingsView struct {
+	director *Director
+	texture  uint32
+	config   *input.Config
+	joystick *input.Profile // profile for the first joystick, if bound
+	action   int
+	released bool // the joystick has been released since the last input
+}
+
+func NewBindingsView(director *Director) View {
+	texture := createTexture()
+	return &BindingsView{director: director, texture: texture}
+}
+
+func (view *BindingsView) Enter() {
+	gl.ClearColor(0, 0, 0, 1)
+	view.director.SetTitle("Controls")
+	view.director.window.SetKeyCallback(view.onKey)
+	// edit a copy of the config
+	data, _ := json.Marshal(inputConfig)
+	view.config, _ = input.ParseConfig(data)
+	view.joystick = nil
+	view.action = 0
+	view.released = false
+	view.updateTexture()
+}
+
+func (view *BindingsView) Exit() {
+	view.director.window.SetKeyCallback(nil)
+}
+
+func (view *BindingsView) Update(t, dt float64) {
+	if glfw.JoystickPresent(glfw.Joystick1) {
+		buttons := glfw.GetJoystickButtons(glfw.Joystick1)
+		axes := glfw.GetJoystickAxes(glfw.Joystick1)
+		name := input.JoystickInput(buttons, axes)
+		if name != "" && view.released {
+			view.bindJoystick(glfw.GetJoystickName(glfw.Joystick1), name)
+		}
+		view.released = name == ""
+	}
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	drawBuffer(view.director.window)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (view *BindingsView) onKey(window *glfw.Window,
+	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press {
+		return
+	}
+	if key == glfw.KeyEscape {
+		view.director.ShowMenu()
+		return
+	}
+	if code := keyCode(key); code != "" {
+		view.config.Keyboard.Bind(input.Actions[view.action], code)
+		view.next()
+	}
+}
+
+func (view *BindingsView) bindJoystick(joyname, name string) {
+	if view.joystick == nil {
+		// start from the current profile, under the joystick's own name
+		profile := input.Profile{Name: joyname, Bindings: map[string][]string{}}
+		if current := view.config.Joystick(joyname); current != nil {
+			for action, inputs := range current.Bindings {
+				profile.Bindings[action] = inputs
+			}
+			profile.Menu = current.Menu
+		}
+		view.joystick = &profile
+	}
+	view.joystick.Bind(input.Actions[view.action], name)
+	view.next()
+}
+
+func (view *BindingsView) next() {
+	view.action++
+	if view.action < len(input.Actions) {
+		view.updateTexture()
+		return
+	}
+	if view.joystick != nil {
+		view.config.SetJoystick(*view.joystick)
+	}
+	inputConfig = view.config
+	if err := inputConfig.Save(inputPath()); err != nil {
+		log.Println(err)
+	}
+	view.director.ShowMenu()
+}
+
+func (view *BindingsView) updateTexture() {
+	im := image.NewRGBA(image.Rect(0, 0, 256, 240))
+	draw.Draw(im, im.Rect, &image.Uniform{color.Black}, image.ZP, draw.Src)
+	gray := color.RGBA{128, 128, 128, 255}
+	action := strings.Replace(input.Actions[view.action], "Turbo", "Turbo ", 1)
+	DrawText(im, 8, 8, "Press a key or", color.White)
+	DrawText(im, 8, 26, "button for", color.White)
+	DrawText(im, 8, 62, strings.ToUpper(action), color.White)
+	DrawText(im, 8, 204, "Esc to cancel", gray)
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	setTexture(im)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
@@ -74,6 +74,20 @@ func (d *Director) Run() {
 }
 
 func (d *Director) PlayGame(path string) {
+	if nes.IsNSFFile(path) {
+		d.PlayMusic(path)
+		return
+	}
+	slot := -1
+	if AutoSave {
+		slot = 0
+	}
+	d.PlayGameSlot(path, slot)
+}
+
+// PlayGameSlot starts a game from a save slot, or from power on if the slot
+// is -1 or empty.
+func (d *Director) PlayGameSlot(path string, slot int) {
 	hash, err := hashFile(path)
 	if err != nil {
 		log.Fatalln(err)
@@ -82,9 +96,30 @@ func (d *Director) PlayGame(path string) {
 	if err != nil {
 		log.Fatalln(err)
 	}
-	d.SetView(NewGameView(d, console, path, hash))
+	d.SetView(NewGameView(d, console, path, hash, slot))
+}
+
+func (d *Director) PlayMusic(path string) {
+	nsf, err := nes.LoadNSFFile(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	d.SetView(NewNSFView(d, nes.NewNSFPlayer(nsf), path))
 }
 
 func (d *Director) ShowMenu() {
 	d.SetView(d.menuView)
 }
+
+func (d *Director) ShowSlots(path string) {
+	hash, err := hashFile(path)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	d.SetView(NewSlotView(d, path, hash))
+}
+
+func (d *Director) ShowBindings() {
+	d.SetView(NewBindingsView(d))
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"image"
+	"log"
 
 	"github.com/fogleman/nes/nes"
 	"github.com/go-gl/gl/v2.1/gl"
@@ -10,6 +11,13 @@ import (
 
 const padding = 0
 
+// rewind snapshots are taken every rewindInterval frames and use up to
+// rewindLimit bytes
+const (
+	rewindInterval = 2
+	rewindLimit    = 64 << 20
+)
+
 type GameView struct {
 	director *Director
 	console  *nes.Console
@@ -18,11 +26,15 @@ type GameView struct {
 	texture  uint32
 	record   bool
 	frames   []image.Image
+	device   nes.InputDevice // peripheral in the second port, or nil
+	adapter  int
+	slot     int     // save slot to start from, or -1
+	playTime float64 // seconds played, carried over in save slots
 }
 
-func NewGameView(director *Director, console *nes.Console, title, hash string) View {
+func NewGameView(director *Director, console *nes.Console, title, hash string, slot int) View {
 	texture := createTexture()
-	return &GameView{director, console, title, hash, texture, false, nil}
+	return &GameView{director, console, title, hash, texture, false, nil, nil, nes.FourPlayerNone, slot, 0}
 }
 
 func (view *GameView) Enter() {
@@ -32,31 +44,46 @@ func (view *GameView) Enter() {
 	view.console.SetAudioSampleRate(view.director.audio.sampleRate)
 	view.director.window.SetKeyCallback(view.onKey)
 	// load state
-	if err := view.console.LoadState(savePath(view.hash)); err == nil {
-		return
-	} else {
+	if view.slot < 0 || view.loadSlot(view.slot) != nil {
 		view.console.Reset()
-	}
-	// load sram
-	cartridge := view.console.Cartridge
-	if cartridge.Battery != 0 {
-		if sram, err := readSRAM(sramPath(view.hash)); err == nil {
-			cartridge.SRAM = sram
+		// load sram
+		cartridge := view.console.Cartridge
+		if cartridge.Battery != 0 {
+			readSRAM(sramPath(view.hash), cartridge.SRAM)
 		}
 	}
+	view.console.SetRewind(rewindInterval, rewindLimit)
 }
 
 func (view *GameView) Exit() {
 	view.director.window.SetKeyCallback(nil)
 	view.console.SetAudioChannel(nil)
 	view.console.SetAudioSampleRate(0)
+	view.console.SetRewind(0, 0)
 	// save sram
 	cartridge := view.console.Cartridge
 	if cartridge.Battery != 0 {
 		writeSRAM(sramPath(view.hash), cartridge.SRAM)
 	}
 	// save state
-	view.console.SaveState(savePath(view.hash))
+	if AutoSave {
+		view.saveSlot(0)
+	}
+}
+
+func (view *GameView) saveSlot(slot int) {
+	if err := saveSlot(view.console, view.hash, slot, view.playTime); err != nil {
+		log.Println(err)
+	}
+}
+
+func (view *GameView) loadSlot(slot int) error {
+	info, err := loadSlot(view.console, view.hash, slot)
+	if err != nil {
+		return err
+	}
+	view.playTime = info.PlayTime
+	return nil
 }
 
 func (view *GameView) Update(t, dt float64) {
@@ -75,7 +102,13 @@ func (view *GameView) Update(t, dt float64) {
 		view.director.ShowMenu()
 	}
 	updateControllers(window, console)
-	console.StepSeconds(dt)
+	updateDevice(window, view.device)
+	if view.rewinding(window) {
+		console.Rewind()
+	} else {
+		console.StepSeconds(dt)
+		view.playTime += dt
+	}
 	gl.BindTexture(gl.TEXTURE_2D, view.texture)
 	setTexture(console.Buffer())
 	drawBuffer(view.director.window)
@@ -87,12 +120,38 @@ func (view *GameView) Update(t, dt float64) {
 
 func (view *GameView) onKey(window *glfw.Window,
 	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if _, ok := view.device.(*nes.Keyboard); ok && mods&glfw.ModControl == 0 {
+		// the keys belong to the Family BASIC keyboard
+		return
+	}
+	if boundKey(key) {
+		// the key presses a controller button instead
+		return
+	}
+	if action == glfw.Press && key >= glfw.KeyF1 && key < glfw.KeyF1+slotCount {
+		// F1-F9 load a slot, Shift+F1-F9 save to it
+		slot := int(key-glfw.KeyF1) + 1
+		if mods&glfw.ModShift != 0 {
+			view.saveSlot(slot)
+		} else if err := view.loadSlot(slot); err != nil {
+			log.Println(err)
+		}
+		return
+	}
 	if action == glfw.Press {
 		switch key {
 		case glfw.KeySpace:
 			screenshot(view.console.Buffer())
 		case glfw.KeyR:
 			view.console.Reset()
+		case glfw.KeyG:
+			view.switchDevice()
+		case glfw.KeyF:
+			view.switchFourPlayer()
+		case glfw.KeyD:
+			if sides := view.console.DiskSides(); sides > 0 {
+				view.console.InsertDisk((view.console.DiskSide() + 1) % sides)
+			}
 		case glfw.KeyTab:
 			if view.record {
 				view.record = false
@@ -105,8 +164,76 @@ func (view *GameView) onKey(window *glfw.Window,
 	}
 }
 
+// rewinding reports whether the rewind key is held, unless it is bound to a
+// controller button. With the Family BASIC keyboard plugged in, Control must
+// be held as well.
+func (view *GameView) rewinding(window *glfw.Window) bool {
+	if boundKey(glfw.KeyBackspace) {
+		return false
+	}
+	if _, ok := view.device.(*nes.Keyboard); ok && !readKey(window, glfw.KeyLeftControl) &&
+		!readKey(window, glfw.KeyRightControl) {
+		return false
+	}
+	return readKey(window, glfw.KeyBackspace)
+}
+
+// switchDevice cycles the second port between the controller, the Zapper,
+// the Arkanoid paddle, the Power Pad and the Family BASIC keyboard.
+func (view *GameView) switchDevice() {
+	console := view.console
+	view.adapter = nes.FourPlayerNone
+	console.SetFourPlayer(view.adapter)
+	var title string
+	switch view.device.(type) {
+	case nil:
+		view.device = nes.NewZapper(console)
+		title = " (Zapper)"
+	case *nes.Zapper:
+		view.device = nes.NewVaus()
+		title = " (Arkanoid Controller)"
+	case *nes.Vaus:
+		view.device = nes.NewPowerPad()
+		title = " (Power Pad)"
+	case *nes.PowerPad:
+		view.device = nes.NewKeyboard()
+		title = " (Family BASIC Keyboard)"
+	default:
+		view.device = nil
+	}
+	if view.device != nil {
+		console.Port2 = view.device
+	}
+	view.director.SetTitle(view.title + title)
+}
+
+// switchFourPlayer cycles between no four player adapter, the Four Score
+// and the Famicom adapter.
+func (view *GameView) switchFourPlayer() {
+	view.adapter = (view.adapter + 1) % 3
+	view.device = nil
+	view.console.SetFourPlayer(view.adapter)
+	titles := []string{"", " (Four Score)", " (Famicom 4 Players)"}
+	view.director.SetTitle(view.title + titles[view.adapter])
+}
+
 func drawBuffer(window *glfw.Window) {
-	w, h := window.GetFramebufferSize()
+	x, y := bufferExtent(window.GetFramebufferSize())
+	gl.Begin(gl.QUADS)
+	gl.TexCoord2f(0, 1)
+	gl.Vertex2f(-x, -y)
+	gl.TexCoord2f(1, 1)
+	gl.Vertex2f(x, -y)
+	gl.TexCoord2f(1, 0)
+	gl.Vertex2f(x, y)
+	gl.TexCoord2f(0, 0)
+	gl.Vertex2f(-x, y)
+	gl.End()
+}
+
+// bufferExtent returns the half width and half height of the screen in
+// normalized device coordinates for a window of size w x h.
+func bufferExtent(w, h int) (float32, float32) {
 	s1 := float32(w) / 256
 	s2 := float32(h) / 240
 	f := float32(1 - padding)
@@ -118,23 +245,35 @@ func drawBuffer(window *glfw.Window) {
 		x = f
 		y = f * s1 / s2
 	}
-	gl.Begin(gl.QUADS)
-	gl.TexCoord2f(0, 1)
-	gl.Vertex2f(-x, -y)
-	gl.TexCoord2f(1, 1)
-	gl.Vertex2f(x, -y)
-	gl.TexCoord2f(1, 0)
-	gl.Vertex2f(x, y)
-	gl.TexCoord2f(0, 0)
-	gl.Vertex2f(-x, y)
-	gl.End()
+	return x, y
+}
+
+func updateDevice(window *glfw.Window, device nes.InputDevice) {
+	switch device := device.(type) {
+	case *nes.Zapper:
+		x, y, trigger := readMouse(window)
+		device.Aim(x, y)
+		device.SetTrigger(trigger)
+	case *nes.Vaus:
+		x, _, button := readMouse(window)
+		device.SetPosition(nes.VausMin + x*(nes.VausMax-nes.VausMin)/255)
+		device.SetButton(button)
+	case *nes.PowerPad:
+		device.SetButtons(readPowerPad(window))
+	case *nes.Keyboard:
+		device.SetKeys(readKeyboard(window))
+	}
 }
 
 func updateControllers(window *glfw.Window, console *nes.Console) {
-	turbo := console.PPU.Frame%6 < 3
+	turbo := inputConfig.Turbo(console.PPU.Frame)
 	k1 := readKeys(window, turbo)
 	j1 := readJoystick(glfw.Joystick1, turbo)
 	j2 := readJoystick(glfw.Joystick2, turbo)
+	j3 := readJoystick(glfw.Joystick3, turbo)
+	j4 := readJoystick(glfw.Joystick4, turbo)
 	console.SetButtons1(combineButtons(k1, j1))
 	console.SetButtons2(j2)
+	console.SetButtons3(j3)
+	console.SetButtons4(j4)
 }
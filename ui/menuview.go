@@ -117,10 +117,28 @@ func (view *MenuView) Enter() {
 	gl.ClearColor(0.333, 0.333, 0.333, 1)
 	view.director.SetTitle("Select Game")
 	view.director.window.SetCharCallback(view.onChar)
+	view.director.window.SetKeyCallback(view.onKey)
 }
 
 func (view *MenuView) Exit() {
 	view.director.window.SetCharCallback(nil)
+	view.director.window.SetKeyCallback(nil)
+}
+
+func (view *MenuView) onKey(window *glfw.Window,
+	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press {
+		return
+	}
+	switch key {
+	case glfw.KeyF1:
+		view.director.ShowBindings()
+	case glfw.KeyF2:
+		index := view.nx*(view.j+view.scroll) + view.i
+		if index < len(view.paths) && !nes.IsNSFFile(view.paths[index]) {
+			view.director.ShowSlots(view.paths[index])
+		}
+	}
 }
 
 func (view *MenuView) Update(t, dt float64) {
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+	"github.com/go-gl/gl/v2.1/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+)
+
+type NSFView struct {
+	director *Director
+	player   *nes.NSFPlayer
+	title    string
+	texture  uint32
+}
+
+func NewNSFView(director *Director, player *nes.NSFPlayer, title string) View {
+	texture := createTexture()
+	return &NSFView{director, player, title, texture}
+}
+
+func (view *NSFView) Enter() {
+	gl.ClearColor(0, 0, 0, 1)
+	view.director.SetTitle(view.title)
+	view.player.Console.SetAudioChannel(view.director.audio.channel)
+	view.player.Console.SetAudioSampleRate(view.director.audio.sampleRate)
+	view.director.window.SetKeyCallback(view.onKey)
+	view.updateTexture()
+	if chips := view.player.NSF.UnsupportedChips(); len(chips) > 0 {
+		log.Printf("%s audio is not supported, those channels will be silent",
+			strings.Join(chips, " and "))
+	}
+}
+
+func (view *NSFView) Exit() {
+	view.director.window.SetKeyCallback(nil)
+	view.player.Console.SetAudioChannel(nil)
+	view.player.Console.SetAudioSampleRate(0)
+}
+
+func (view *NSFView) Update(t, dt float64) {
+	if dt > 1 {
+		dt = 0
+	}
+	window := view.director.window
+	if joystickReset(glfw.Joystick1) {
+		view.director.ShowMenu()
+	}
+	if readKey(window, glfw.KeyEscape) {
+		view.director.ShowMenu()
+	}
+	view.player.StepSeconds(dt)
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	drawBuffer(view.director.window)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (view *NSFView) onKey(window *glfw.Window,
+	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action == glfw.Press {
+		song := view.player.Song()
+		switch key {
+		case glfw.KeyLeft:
+			song--
+		case glfw.KeyRight:
+			song++
+		case glfw.KeyR, glfw.KeyEnter:
+		default:
+			return
+		}
+		if song < 0 || song >= view.player.NSF.Songs {
+			return
+		}
+		view.player.Play(song)
+		view.updateTexture()
+	}
+}
+
+// updateTexture draws the track list screen: the file information at the
+// top and the current track below it.
+func (view *NSFView) updateTexture() {
+	nsf := view.player.NSF
+	song := view.player.Song()
+	im := image.NewRGBA(image.Rect(0, 0, 256, 240))
+	draw.Draw(im, im.Rect, &image.Uniform{color.Black}, image.ZP, draw.Src)
+	gray := color.RGBA{128, 128, 128, 255}
+	y := 8
+	for _, text := range []string{nsf.Name, nsf.Artist, nsf.Copyright} {
+		for _, row := range WordWrap(text, 15) {
+			DrawText(im, 8, y, row, color.White)
+			y += 18
+		}
+	}
+	// channels of chips that are not emulated are silent
+	if chips := nsf.UnsupportedChips(); len(chips) > 0 {
+		text := "No " + strings.Join(chips, "/") + " audio"
+		for _, row := range WordWrap(text, 15) {
+			DrawText(im, 8, y, row, gray)
+			y += 18
+		}
+	}
+	y += 18
+	DrawText(im, 8, y, fmt.Sprintf("< %d / %d >", song+1, nsf.Songs), color.White)
+	y += 26
+	for _, row := range WordWrap(nsf.Title(song), 15) {
+		DrawText(im, 8, y, row, gray)
+		y += 18
+	}
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	setTexture(im)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
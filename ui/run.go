@@ -2,8 +2,10 @@ package ui
 
 import (
 	"log"
+	"os"
 	"runtime"
 
+	"github.com/fogleman/nes/input"
 	"github.com/go-gl/gl/v2.1/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/gordonklaus/portaudio"
@@ -25,6 +27,13 @@ func init() {
 }
 
 func Run(paths []string) {
+	// load the key and joystick bindings
+	if config, err := input.LoadConfig(inputPath()); err == nil {
+		inputConfig = config
+	} else if !os.IsNotExist(err) {
+		log.Println(err)
+	}
+
 	// initialize audio
 	portaudio.Initialize()
 	defer portaudio.Terminate()
@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/fogleman/nes/nes"
+	"github.com/go-gl/gl/v2.1/gl"
+	"github.com/go-gl/glfw/v3.2/glfw"
+)
+
+// number of save slots with hotkeys; slot 0 is the auto-save
+const slotCount = 9
+
+// slotInfo is the metadata stored next to a save slot.
+type slotInfo struct {
+	Time     time.Time // when the slot was saved
+	PlayTime float64   // seconds played, including earlier sessions
+	Frame    uint64    // PPU frame number
+}
+
+// saveSlot writes the console state to a slot along with a thumbnail of the
+// screen and the slot metadata.
+func saveSlot(console *nes.Console, hash string, slot int, playTime float64) error {
+	base := slotPath(hash, slot)
+	if err := console.SaveState(base + ".dat"); err != nil {
+		return err
+	}
+	if err := savePNG(base+".png", console.Buffer()); err != nil {
+		return err
+	}
+	info := slotInfo{time.Now(), playTime, console.PPU.Frame}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(base+".json", data, 0644)
+}
+
+// loadSlot restores the console state from a slot. The metadata is optional,
+// as auto-saves from older versions do not have it.
+func loadSlot(console *nes.Console, hash string, slot int) (*slotInfo, error) {
+	if err := console.LoadState(slotPath(hash, slot) + ".dat"); err != nil {
+		return nil, err
+	}
+	info, err := readSlotInfo(hash, slot)
+	if err != nil {
+		return &slotInfo{Frame: console.PPU.Frame}, nil
+	}
+	return info, nil
+}
+
+func readSlotInfo(hash string, slot int) (*slotInfo, error) {
+	data, err := ioutil.ReadFile(slotPath(hash, slot) + ".json")
+	if err != nil {
+		return nil, err
+	}
+	info := slotInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SlotView browses the save slots of a game.
+type SlotView struct {
+	director *Director
+	path     string
+	hash     string
+	texture  uint32
+	slot     int
+	saved    bool      // whether the slot holds a state
+	info     *slotInfo // nil if the slot is empty or has no metadata
+}
+
+func NewSlotView(director *Director, path, hash string) View {
+	texture := createTexture()
+	return &SlotView{director: director, path: path, hash: hash, texture: texture}
+}
+
+func (view *SlotView) Enter() {
+	gl.ClearColor(0, 0, 0, 1)
+	_, name := path.Split(view.path)
+	view.director.SetTitle(name + " (Save Slots)")
+	view.director.window.SetKeyCallback(view.onKey)
+	view.updateTexture()
+}
+
+func (view *SlotView) Exit() {
+	view.director.window.SetKeyCallback(nil)
+}
+
+func (view *SlotView) Update(t, dt float64) {
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	drawBuffer(view.director.window)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (view *SlotView) onKey(window *glfw.Window,
+	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press && action != glfw.Repeat {
+		return
+	}
+	switch key {
+	case glfw.KeyEscape:
+		view.director.ShowMenu()
+	case glfw.KeyEnter:
+		if view.saved {
+			view.director.PlayGameSlot(view.path, view.slot)
+		}
+	case glfw.KeyLeft:
+		view.slot = (view.slot + slotCount) % (slotCount + 1)
+		view.updateTexture()
+	case glfw.KeyRight:
+		view.slot = (view.slot + 1) % (slotCount + 1)
+		view.updateTexture()
+	}
+}
+
+// updateTexture draws the thumbnail of the current slot with its metadata
+// below it.
+func (view *SlotView) updateTexture() {
+	im := image.NewRGBA(image.Rect(0, 0, 256, 240))
+	draw.Draw(im, im.Rect, &image.Uniform{color.Black}, image.ZP, draw.Src)
+	_, err := os.Stat(slotPath(view.hash, view.slot) + ".dat")
+	view.saved = err == nil
+	view.info, _ = readSlotInfo(view.hash, view.slot)
+	if thumbnail, err := loadPNG(slotPath(view.hash, view.slot) + ".png"); err == nil {
+		draw.Draw(im, im.Rect, thumbnail, image.ZP, draw.Src)
+		// darken the thumbnail so that the text stands out
+		shade := &image.Uniform{color.RGBA{0, 0, 0, 160}}
+		draw.Draw(im, im.Rect, shade, image.ZP, draw.Over)
+	}
+	gray := color.RGBA{160, 160, 160, 255}
+	name := fmt.Sprintf("< SLOT %d >", view.slot)
+	if view.slot == 0 {
+		name = "< AUTO-SAVE >"
+	}
+	DrawText(im, 8, 8, name, color.White)
+	if !view.saved {
+		DrawText(im, 8, 34, "Empty", gray)
+	} else if view.info != nil {
+		info := view.info
+		DrawText(im, 8, 34, info.Time.Format("2006-01-02"), gray)
+		DrawText(im, 8, 52, info.Time.Format("15:04:05"), gray)
+		seconds := int(info.PlayTime)
+		played := fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+		DrawText(im, 8, 78, "Played "+played, gray)
+		DrawText(im, 8, 96, fmt.Sprintf("Frame %d", info.Frame), gray)
+	}
+	if view.saved {
+		DrawText(im, 8, 214, "Enter to load", gray)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, view.texture)
+	setTexture(im)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
@@ -3,11 +3,13 @@ package ui
 import (
 	"image"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"strings"
 
+	"github.com/fogleman/nes/nes"
 	"github.com/go-gl/gl/v2.1/gl"
 )
 
@@ -109,9 +111,14 @@ func (t *Texture) load(path string) int {
 
 func (t *Texture) loadThumbnail(romPath string) image.Image {
 	_, name := path.Split(romPath)
-	name = strings.TrimSuffix(name, ".nes")
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, path.Ext(name))
 	name = strings.Replace(name, "_", " ", -1)
 	name = strings.Title(name)
+	if game, ok := lookupGame(romPath); ok {
+		// prefer the name of the game in the database
+		name = game.Name
+	}
 	im := CreateGenericThumbnail(name)
 	hash, err := hashFile(romPath)
 	if err != nil {
@@ -130,6 +137,23 @@ func (t *Texture) loadThumbnail(romPath string) image.Image {
 	}
 }
 
+// lookupGame finds a rom in the game database by the hash of its PRG-ROM and
+// CHR-ROM, without loading a cartridge.
+func lookupGame(romPath string) (*nes.GameInfo, bool) {
+	if nes.GameDatabase.Len() == 0 {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(romPath)
+	if err != nil {
+		return nil, false
+	}
+	data, err = nes.ExtractROM(data, "")
+	if err != nil {
+		return nil, false
+	}
+	return nes.GameDatabase.LookupImage(data)
+}
+
 func (t *Texture) downloadThumbnail(romPath, hash string) error {
 	url := thumbnailURL(hash)
 	filename := thumbnailPath(hash)
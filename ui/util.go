@@ -15,6 +15,7 @@ import (
 	"os/user"
 	"path"
 
+	"github.com/fogleman/nes/input"
 	"github.com/fogleman/nes/nes"
 	"github.com/go-gl/gl/v2.1/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
@@ -22,12 +23,24 @@ import (
 
 var homeDir string
 
+// AutoSave makes games resume from where they were left, by saving the state
+// on exit and loading it on start.
+var AutoSave = true
+
+// inputConfig holds the key and joystick bindings.
+var inputConfig = input.DefaultConfig()
+
 func init() {
 	u, err := user.Current()
 	if err != nil {
 		log.Fatalln(err)
 	}
 	homeDir = u.HomeDir
+	nes.FDSBIOSPath = homeDir + "/.nes/disksys.rom"
+}
+
+func inputPath() string {
+	return homeDir + "/.nes/input.json"
 }
 
 func thumbnailURL(hash string) string {
@@ -42,69 +55,235 @@ func sramPath(hash string) string {
 	return homeDir + "/.nes/sram/" + hash + ".dat"
 }
 
-func savePath(hash string) string {
-	return homeDir + "/.nes/save/" + hash + ".dat"
+// slotPath returns the path of a save slot without its extension. Slot 0 is
+// the auto-save.
+func slotPath(hash string, slot int) string {
+	if slot == 0 {
+		return homeDir + "/.nes/save/" + hash
+	}
+	return fmt.Sprintf("%s/.nes/save/%s-%d", homeDir, hash, slot)
 }
 
 func readKey(window *glfw.Window, key glfw.Key) bool {
 	return window.GetKey(key) == glfw.Press
 }
 
-func readKeys(window *glfw.Window, turbo bool) [8]bool {
-	var result [8]bool
-	result[nes.ButtonA] = readKey(window, glfw.KeyZ) || (turbo && readKey(window, glfw.KeyA))
-	result[nes.ButtonB] = readKey(window, glfw.KeyX) || (turbo && readKey(window, glfw.KeyS))
-	result[nes.ButtonSelect] = readKey(window, glfw.KeyRightShift)
-	result[nes.ButtonStart] = readKey(window, glfw.KeyEnter)
-	result[nes.ButtonUp] = readKey(window, glfw.KeyUp)
-	result[nes.ButtonDown] = readKey(window, glfw.KeyDown)
-	result[nes.ButtonLeft] = readKey(window, glfw.KeyLeft)
-	result[nes.ButtonRight] = readKey(window, glfw.KeyRight)
+// readMouse returns the screen pixel under the cursor and whether the left
+// button is pressed.
+func readMouse(window *glfw.Window) (int, int, bool) {
+	w, h := window.GetSize()
+	if w == 0 || h == 0 {
+		return -1, -1, false
+	}
+	ex, ey := bufferExtent(w, h)
+	cx, cy := window.GetCursorPos()
+	u := float32(cx)/float32(w)*2 - 1
+	v := 1 - float32(cy)/float32(h)*2
+	x := int((u + ex) / (2 * ex) * 256)
+	y := int((ey - v) / (2 * ey) * 240)
+	trigger := window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+	return x, y, trigger
+}
+
+// powerPadKeys are the keys for Power Pad buttons 1-12, laid out in the same
+// three rows of four as on the mat.
+var powerPadKeys = [12]glfw.Key{
+	glfw.KeyU, glfw.KeyI, glfw.KeyO, glfw.KeyP,
+	glfw.KeyJ, glfw.KeyK, glfw.KeyL, glfw.KeySemicolon,
+	glfw.KeyM, glfw.KeyComma, glfw.KeyPeriod, glfw.KeySlash,
+}
+
+func readPowerPad(window *glfw.Window) [12]bool {
+	var result [12]bool
+	for i, key := range powerPadKeys {
+		result[i] = readKey(window, key)
+	}
 	return result
 }
 
-func readJoystick(joy glfw.Joystick, turbo bool) [8]bool {
-	var result [8]bool
-	if !glfw.JoystickPresent(joy) {
-		return result
-	}
-	joyname := glfw.GetJoystickName(joy)
-	axes := glfw.GetJoystickAxes(joy)
-	buttons := glfw.GetJoystickButtons(joy)
-	if joyname == "PLAYSTATION(R)3 Controller" {
-		result[nes.ButtonA] = buttons[14] == 1 || (turbo && buttons[2] == 1)
-		result[nes.ButtonB] = buttons[13] == 1 || (turbo && buttons[3] == 1)
-		result[nes.ButtonSelect] = buttons[0] == 1
-		result[nes.ButtonStart] = buttons[3] == 1
-		result[nes.ButtonUp] = buttons[4] == 1 || axes[1] < -0.5
-		result[nes.ButtonDown] = buttons[6] == 1 || axes[1] > 0.5
-		result[nes.ButtonLeft] = buttons[7] == 1 || axes[0] < -0.5
-		result[nes.ButtonRight] = buttons[5] == 1 || axes[0] > 0.5
-		return result
-	}
-	if len(buttons) < 8 {
-		return result
-	}
-	result[nes.ButtonA] = buttons[0] == 1 || (turbo && buttons[2] == 1)
-	result[nes.ButtonB] = buttons[1] == 1 || (turbo && buttons[3] == 1)
-	result[nes.ButtonSelect] = buttons[6] == 1
-	result[nes.ButtonStart] = buttons[7] == 1
-	result[nes.ButtonUp] = axes[1] < -0.5
-	result[nes.ButtonDown] = axes[1] > 0.5
-	result[nes.ButtonLeft] = axes[0] < -0.5
-	result[nes.ButtonRight] = axes[0] > 0.5
+// keyboardKeys maps the Family BASIC keyboard to the host keyboard, by
+// character where possible and by position otherwise.
+var keyboardKeys = map[int]glfw.Key{
+	nes.KeyRightBracket: glfw.KeyRightBracket,
+	nes.KeyLeftBracket:  glfw.KeyLeftBracket,
+	nes.KeyReturn:       glfw.KeyEnter,
+	nes.KeyStop:         glfw.KeyEnd,
+	nes.KeyYen:          glfw.KeyBackslash,
+	nes.KeyRightShift:   glfw.KeyRightShift,
+	nes.KeyKana:         glfw.KeyRightAlt,
+	nes.KeySemicolon:    glfw.KeySemicolon,
+	nes.KeyColon:        glfw.KeyApostrophe,
+	nes.KeyAt:           glfw.KeyGraveAccent,
+	nes.KeyCaret:        glfw.KeyEqual,
+	nes.KeyMinus:        glfw.KeyMinus,
+	nes.KeySlash:        glfw.KeySlash,
+	nes.KeyUnderscore:   glfw.KeyRightControl,
+	nes.KeyComma:        glfw.KeyComma,
+	nes.KeyPeriod:       glfw.KeyPeriod,
+	nes.KeyControl:      glfw.KeyLeftControl,
+	nes.KeyEscape:       glfw.KeyTab,
+	nes.KeyGraph:        glfw.KeyLeftAlt,
+	nes.KeyLeftShift:    glfw.KeyLeftShift,
+	nes.KeyLeft:         glfw.KeyLeft,
+	nes.KeyRight:        glfw.KeyRight,
+	nes.KeyUp:           glfw.KeyUp,
+	nes.KeyDown:         glfw.KeyDown,
+	nes.KeyClearHome:    glfw.KeyHome,
+	nes.KeyInsert:       glfw.KeyInsert,
+	nes.KeyDelete:       glfw.KeyBackspace,
+	nes.KeySpace:        glfw.KeySpace,
+	nes.KeyF1:           glfw.KeyF1,
+	nes.KeyF2:           glfw.KeyF2,
+	nes.KeyF3:           glfw.KeyF3,
+	nes.KeyF4:           glfw.KeyF4,
+	nes.KeyF5:           glfw.KeyF5,
+	nes.KeyF6:           glfw.KeyF6,
+	nes.KeyF7:           glfw.KeyF7,
+	nes.KeyF8:           glfw.KeyF8,
+	nes.Key0:            glfw.Key0,
+	nes.Key1:            glfw.Key1,
+	nes.Key2:            glfw.Key2,
+	nes.Key3:            glfw.Key3,
+	nes.Key4:            glfw.Key4,
+	nes.Key5:            glfw.Key5,
+	nes.Key6:            glfw.Key6,
+	nes.Key7:            glfw.Key7,
+	nes.Key8:            glfw.Key8,
+	nes.Key9:            glfw.Key9,
+	nes.KeyA:            glfw.KeyA,
+	nes.KeyB:            glfw.KeyB,
+	nes.KeyC:            glfw.KeyC,
+	nes.KeyD:            glfw.KeyD,
+	nes.KeyE:            glfw.KeyE,
+	nes.KeyF:            glfw.KeyF,
+	nes.KeyG:            glfw.KeyG,
+	nes.KeyH:            glfw.KeyH,
+	nes.KeyI:            glfw.KeyI,
+	nes.KeyJ:            glfw.KeyJ,
+	nes.KeyK:            glfw.KeyK,
+	nes.KeyL:            glfw.KeyL,
+	nes.KeyM:            glfw.KeyM,
+	nes.KeyN:            glfw.KeyN,
+	nes.KeyO:            glfw.KeyO,
+	nes.KeyP:            glfw.KeyP,
+	nes.KeyQ:            glfw.KeyQ,
+	nes.KeyR:            glfw.KeyR,
+	nes.KeyS:            glfw.KeyS,
+	nes.KeyT:            glfw.KeyT,
+	nes.KeyU:            glfw.KeyU,
+	nes.KeyV:            glfw.KeyV,
+	nes.KeyW:            glfw.KeyW,
+	nes.KeyX:            glfw.KeyX,
+	nes.KeyY:            glfw.KeyY,
+	nes.KeyZ:            glfw.KeyZ,
+}
+
+func readKeyboard(window *glfw.Window) [nes.KeyboardKeys]bool {
+	var result [nes.KeyboardKeys]bool
+	for key, hostKey := range keyboardKeys {
+		result[key] = readKey(window, hostKey)
+	}
 	return result
 }
 
-func joystickReset(joy glfw.Joystick) bool {
+// keyCodes maps the KeyboardEvent.code names used in the bindings config to
+// GLFW keys.
+var keyCodes = map[string]glfw.Key{
+	"Space":        glfw.KeySpace,
+	"Quote":        glfw.KeyApostrophe,
+	"Comma":        glfw.KeyComma,
+	"Minus":        glfw.KeyMinus,
+	"Period":       glfw.KeyPeriod,
+	"Slash":        glfw.KeySlash,
+	"Semicolon":    glfw.KeySemicolon,
+	"Equal":        glfw.KeyEqual,
+	"BracketLeft":  glfw.KeyLeftBracket,
+	"Backslash":    glfw.KeyBackslash,
+	"BracketRight": glfw.KeyRightBracket,
+	"Backquote":    glfw.KeyGraveAccent,
+	"Escape":       glfw.KeyEscape,
+	"Enter":        glfw.KeyEnter,
+	"Tab":          glfw.KeyTab,
+	"Backspace":    glfw.KeyBackspace,
+	"Insert":       glfw.KeyInsert,
+	"Delete":       glfw.KeyDelete,
+	"ArrowRight":   glfw.KeyRight,
+	"ArrowLeft":    glfw.KeyLeft,
+	"ArrowDown":    glfw.KeyDown,
+	"ArrowUp":      glfw.KeyUp,
+	"PageUp":       glfw.KeyPageUp,
+	"PageDown":     glfw.KeyPageDown,
+	"Home":         glfw.KeyHome,
+	"End":          glfw.KeyEnd,
+	"CapsLock":     glfw.KeyCapsLock,
+	"ShiftLeft":    glfw.KeyLeftShift,
+	"ControlLeft":  glfw.KeyLeftControl,
+	"AltLeft":      glfw.KeyLeftAlt,
+	"ShiftRight":   glfw.KeyRightShift,
+	"ControlRight": glfw.KeyRightControl,
+	"AltRight":     glfw.KeyRightAlt,
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		keyCodes["Key"+string(rune('A'+i))] = glfw.KeyA + glfw.Key(i)
+	}
+	for i := 0; i < 10; i++ {
+		keyCodes["Digit"+string(rune('0'+i))] = glfw.Key0 + glfw.Key(i)
+	}
+	for i := 0; i < 12; i++ {
+		keyCodes[fmt.Sprintf("F%d", i+1)] = glfw.KeyF1 + glfw.Key(i)
+	}
+}
+
+// keyCode returns the config name of a GLFW key, or an empty string.
+func keyCode(key glfw.Key) string {
+	for code, k := range keyCodes {
+		if k == key {
+			return code
+		}
+	}
+	return ""
+}
+
+// boundKey reports whether a key is bound to a controller button, in which
+// case it is not a hotkey.
+func boundKey(key glfw.Key) bool {
+	code := keyCode(key)
+	return code != "" && inputConfig.Keyboard.Bound(code)
+}
+
+func readKeys(window *glfw.Window, turbo bool) [8]bool {
+	pressed := func(code string) bool {
+		key, ok := keyCodes[code]
+		return ok && readKey(window, key)
+	}
+	return inputConfig.Keyboard.Buttons(pressed, turbo)
+}
+
+// joystickState returns the profile, buttons and axes of a joystick, or a
+// nil profile if it is not present.
+func joystickState(joy glfw.Joystick) (*input.Profile, []byte, []float32) {
 	if !glfw.JoystickPresent(joy) {
-		return false
+		return nil, nil, nil
 	}
-	buttons := glfw.GetJoystickButtons(joy)
-	if len(buttons) < 6 {
-		return false
+	profile := inputConfig.Joystick(glfw.GetJoystickName(joy))
+	return profile, glfw.GetJoystickButtons(joy), glfw.GetJoystickAxes(joy)
+}
+
+func readJoystick(joy glfw.Joystick, turbo bool) [8]bool {
+	profile, buttons, axes := joystickState(joy)
+	pressed := func(name string) bool {
+		return input.JoystickPressed(name, buttons, axes)
 	}
-	return buttons[4] == 1 && buttons[5] == 1
+	return profile.Buttons(pressed, turbo)
+}
+
+func joystickReset(joy glfw.Joystick) bool {
+	profile, buttons, axes := joystickState(joy)
+	return profile.MenuPressed(func(name string) bool {
+		return input.JoystickPressed(name, buttons, axes)
+	})
 }
 
 func combineButtons(a, b [8]bool) [8]bool {
@@ -115,11 +294,17 @@ func combineButtons(a, b [8]bool) [8]bool {
 	return result
 }
 
+// hashFile returns the md5 sum of a rom file. Archives are hashed by their
+// contents, so that thumbnails and saves are shared with the plain rom.
 func hashFile(path string) (string, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
+	data, err = nes.ExtractROM(data, "")
+	if err != nil {
+		return "", err
+	}
 	return fmt.Sprintf("%x", md5.Sum(data)), nil
 }
 
@@ -222,15 +407,11 @@ func writeSRAM(filename string, sram []byte) error {
 	return binary.Write(file, binary.LittleEndian, sram)
 }
 
-func readSRAM(filename string) ([]byte, error) {
-	file, err := os.Open(filename)
+func readSRAM(filename string, sram []byte) error {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	sram := make([]byte, 0x2000)
-	if err := binary.Read(file, binary.LittleEndian, sram); err != nil {
-		return nil, err
+		return err
 	}
-	return sram, nil
+	copy(sram, data)
+	return nil
 }
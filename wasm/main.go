@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
+	"math"
 	"syscall/js"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fogleman/nes/activity"
+	"github.com/fogleman/nes/input"
 	"github.com/fogleman/nes/nes"
 )
 
@@ -16,6 +20,28 @@ const (
 	NES_HEIGHT = 240
 )
 
+// the loop wakes up every tickInterval and runs the frames that are due,
+// rendering only the last of them. It falls behind, slowing the game down,
+// rather than run more than maxFramesPerTick frames at once.
+const (
+	tickInterval     = time.Second / 60
+	maxFramesPerTick = 4
+)
+
+// the audio ring buffer is kept about audioLatency seconds full by
+// resampling by up to audioMaxCorrection
+const (
+	audioLatency       = 0.05
+	audioMaxCorrection = 0.005
+)
+
+// rewind snapshots are taken every rewindInterval frames and use up to
+// rewindLimit bytes
+const (
+	rewindInterval = 2
+	rewindLimit    = 32 << 20
+)
+
 var preimageCache = map[common.Hash][]byte{}
 
 func main() {
@@ -24,20 +50,24 @@ func main() {
 
 	kb := NewKeyboard()
 	renderer := NewRenderer()
+	pointer := NewPointer(renderer.canvas)
 	api := NewAPI()
-	governor := NewMovingAverage(60)
 	recorder := NewRecorder()
+	var audio *audio
 
 	var machine *nes.Console
+	var game cartridge // the states the recording starts from
+	var zapper *nes.Zapper
+	var pads [activity.Ports][8]bool // buttons set through the API, by port
 
-	spf := time.Second / 30
-	spfMs := int(spf.Milliseconds())
 	speed := 1.0
+	due := 0.0 // frames owed to the wall clock
+	last := time.Now()
 
 	<-api.startChan
 	fmt.Println("[wasm] Starting")
 
-	ticker := time.NewTicker(spf)
+	ticker := time.NewTicker(tickInterval)
 	defer ticker.Stop()
 
 	for {
@@ -61,23 +91,28 @@ func main() {
 					break pause
 				}
 			}
+			// the time spent paused is not owed
+			last = time.Now()
 			fmt.Println("[wasm] Unpaused")
 		case <-api.requestActivityChan:
 			fmt.Println("[wasm] Requesting activity")
 			if machine == nil {
 				api.returnHashChan <- common.Hash{}
-				api.returnActivityChan <- []Action{}
+				api.returnActivityChan <- []activity.Action{}
+				api.returnCartridgeChan <- cartridge{}
 				continue
 			}
-			// dyn, err := machine.SerializeDynamic()
-			// if err != nil {
-			// 	panic(err)
-			// }
-			// hash := crypto.Keccak256Hash(dyn)
-			// preimageCache[hash] = dyn
-			// fmt.Println("[wasm] Cached dynamic state", hash.Hex())
-			api.returnHashChan <- common.Hash{}
+			// commit to the state the activity leads to
+			dyn, err := machine.SerializeDynamic()
+			if err != nil {
+				panic(err)
+			}
+			hash := crypto.Keccak256Hash(dyn)
+			preimageCache[hash] = dyn
+			fmt.Println("[wasm] Cached dynamic state", hash.Hex())
+			api.returnHashChan <- hash
 			api.returnActivityChan <- recorder.getActivity()
+			api.returnCartridgeChan <- game
 			fmt.Println("[wasm] Returned activity")
 		case newSpeed := <-api.speedChan:
 			fmt.Println("[wasm] Changing speed to", newSpeed)
@@ -92,6 +127,8 @@ func main() {
 			}
 			preimageCache[preimage.hash] = preimage.data
 			fmt.Println("[wasm] Set preimage")
+		case hash := <-api.requestPreimageChan:
+			api.returnPreimageChan <- preimageCache[hash]
 		case cartridge := <-api.cartridgeChan:
 			fmt.Println("[wasm] Loading cartridge", cartridge.static, cartridge.dyn)
 			staticData, ok := preimageCache[cartridge.static]
@@ -107,51 +144,174 @@ func main() {
 			fmt.Println("[wasm] Static preimage length:", len(staticData))
 			fmt.Println("[wasm] Dynamic preimage length:", len(dynData))
 			var err error
-			machine, err = nes.NewHeadlessConsole(staticData, dynData, false)
+			machine, err = nes.NewHeadlessConsole(staticData, dynData, true)
 			if err != nil {
 				fmt.Println("[wasm] Error loading cartridge:", err)
 				continue
 			}
+			game = cartridge
+			zapper = nil
+			machine.SetRewind(rewindInterval, rewindLimit)
+			audio.attach(machine)
 			fmt.Println("[wasm] Loaded cartridge")
 			fmt.Println("[wasm] Resetting recorder")
 			recorder.reset()
+			recorder.start = machine.CPU.Cycles
 			fmt.Println("[wasm] Reset recorder")
+		case rom := <-api.romChan:
+			fmt.Println("[wasm] Loading rom")
+			fmt.Println("[wasm] Rom length:", len(rom))
+			cart, err := nes.LoadCartridgeData(rom, "")
+			if err != nil {
+				fmt.Println("[wasm] Error loading rom:", err)
+				continue
+			}
+			console, err := nes.NewConsoleFromCartridge(cart)
+			if err != nil {
+				fmt.Println("[wasm] Error loading rom:", err)
+				continue
+			}
+			// the rom's states are cached as preimages, so that its sessions
+			// can be submitted along with them, and the game is run from
+			// them, as the server replays it
+			staticData, err := console.SerializeStatic()
+			if err != nil {
+				fmt.Println("[wasm] Error loading rom:", err)
+				continue
+			}
+			dynData, err := console.SerializeDynamic()
+			if err != nil {
+				fmt.Println("[wasm] Error loading rom:", err)
+				continue
+			}
+			machine, err = nes.NewHeadlessConsole(staticData, dynData, true)
+			if err != nil {
+				fmt.Println("[wasm] Error loading rom:", err)
+				continue
+			}
+			game = cartridge{crypto.Keccak256Hash(staticData), crypto.Keccak256Hash(dynData)}
+			preimageCache[game.static] = staticData
+			preimageCache[game.dyn] = dynData
+			zapper = nil
+			machine.SetRewind(rewindInterval, rewindLimit)
+			audio.attach(machine)
+			fmt.Println("[wasm] Loaded rom")
+			recorder.reset()
+			recorder.start = machine.CPU.Cycles
+		case steps := <-api.rewindChan:
+			if machine == nil {
+				continue
+			}
+			for i := 0; i < steps; i++ {
+				if !machine.Rewind() {
+					break
+				}
+			}
+			// drop the activity that was rewound over, so that replaying
+			// it still ends in the current state
+			recorder.truncate(machine.CPU.Cycles - recorder.start)
+			renderer.renderImage(machine.Buffer())
+		case a := <-api.audioChan:
+			fmt.Println("[wasm] Setting audio output at", a.sampleRate, "Hz")
+			audio = a
+			audio.attach(machine)
+		case muted := <-api.muteChan:
+			audio.setMuted(muted)
+		case b := <-api.buttonChan:
+			pads[b.port][b.button] = b.pressed
+		case event := <-api.eventChan:
+			if machine == nil {
+				continue
+			}
+			var err error
+			switch event.Event {
+			case activity.EventReset:
+				fmt.Println("[wasm] Resetting console")
+				machine.Reset()
+			case activity.EventPower:
+				fmt.Println("[wasm] Power cycling console")
+				err = machine.Power()
+			case activity.EventDisk:
+				fmt.Println("[wasm] Inserting disk side", event.Button)
+				err = machine.InsertDisk(int(event.Button))
+			case activity.EventZapper:
+				if zapper != nil {
+					continue
+				}
+				fmt.Println("[wasm] Plugging in zapper")
+				zapper = nes.NewZapper(machine)
+				machine.Port2 = zapper
+				// rewinding stops where the zapper was plugged in, as the
+				// snapshots before hold the state of a controller instead
+				machine.SetRewind(rewindInterval, rewindLimit)
+			case activity.EventFourPlayer:
+				fmt.Println("[wasm] Plugging in four player adapter", event.Button)
+				machine.SetFourPlayer(int(event.Button))
+				zapper = nil
+				// as for the zapper, the snapshots before hold other ports
+				machine.SetRewind(rewindInterval, rewindLimit)
+			}
+			if err != nil {
+				fmt.Println("[wasm] Error:", err)
+				continue
+			}
+			recorder.event(event)
+		case data := <-api.inputConfigChan:
+			fmt.Println("[wasm] Setting input config")
+			config, err := input.ParseConfig(data)
+			if err != nil {
+				fmt.Println("[wasm] Error parsing input config:", err)
+				continue
+			}
+			kb.config = config
+			fmt.Println("[wasm] Set input config")
 		case <-ticker.C:
+			now := time.Now()
+			elapsed := now.Sub(last)
+			last = now
 			if machine == nil {
 				continue
 			}
 
-			startTime := time.Now()
-
-			controller := kb.getController()
-			machine.Controller1.SetButtons(controller)
-			targetCycles := int(speed * spf.Seconds() * nes.CPUFrequency)
-			execCycles := 0
-
-			for execCycles < targetCycles {
-				execCycles += machine.Step()
+			due += elapsed.Seconds() * speed * machine.FrameRate()
+			if due > maxFramesPerTick {
+				due = maxFramesPerTick
+			}
+			if due < 1 {
+				continue
 			}
 
-			recorder.record(controller, uint32(execCycles))
-			renderer.renderImage(machine.Buffer())
-
-			elapsedTime := time.Since(startTime)
-			avgMs := governor.Add(int(elapsedTime.Milliseconds()))
-
-			if avgMs > spfMs-5 {
-				fmt.Println("[wasm] Ticking is taking too long:", int(avgMs), "ms/tick")
-				newSpeed := speed * 0.99
-				speed = newSpeed
-				fmt.Println("[wasm] New speed:", speed)
-			} else if speed < 1.0 && avgMs < spfMs-10 {
-				fmt.Println("[wasm] Ticking is quick:", int(avgMs), "ms/tick")
-				newSpeed := speed * 1.01
-				if newSpeed > 1.0 {
-					newSpeed = 1.0
+			// input is sampled once per frame, so that the activity log is
+			// made of whole frames whatever the speed of the host
+			for ; due >= 1; due-- {
+				buttons := pads
+				keys := kb.getController(kb.config.Turbo(machine.PPU.Frame))
+				for i, pressed := range keys {
+					buttons[0][i] = buttons[0][i] || pressed
+				}
+				recorder.setButtons(buttons)
+				controllers := [activity.Ports]*nes.Controller{
+					machine.Controller1, machine.Controller2,
+					machine.Controller3, machine.Controller4,
 				}
-				speed = newSpeed
-				fmt.Println("[wasm] New speed:", speed)
+				for port, controller := range controllers {
+					if recorder.used[port] {
+						controller.SetButtons(buttons[port])
+					}
+				}
+				if zapper != nil {
+					x, y := pointer.x, pointer.y
+					if x < 0 || x >= NES_WIDTH || y < 0 || y >= NES_HEIGHT {
+						x, y = -1, -1
+					}
+					recorder.aim(x, y, pointer.down)
+					zapper.Aim(x, y)
+					zapper.SetTrigger(pointer.down)
+				}
+				recorder.advance(uint32(machine.StepFrame()))
 			}
+			renderer.renderImage(machine.Buffer())
+			audio.write(speed)
 		}
 	}
 }
@@ -166,6 +326,11 @@ type cartridge struct {
 	dyn    common.Hash
 }
 
+type button struct {
+	port, button int
+	pressed      bool
+}
+
 type nesApi struct {
 	startChan                chan struct{}
 	pauseChan                chan struct{}
@@ -173,10 +338,20 @@ type nesApi struct {
 	speedChan                chan float64
 	preimageChan             chan preimage
 	cartridgeChan            chan cartridge
+	romChan                  chan []byte
+	inputConfigChan          chan []byte
+	buttonChan               chan button
+	eventChan                chan activity.Action
+	audioChan                chan *audio
+	muteChan                 chan bool
+	rewindChan               chan int
 	requestActivityChan      chan struct{}
-	returnActivityChan       chan []Action
+	returnActivityChan       chan []activity.Action
 	requestCachePreimageChan chan struct{}
 	returnHashChan           chan common.Hash
+	returnCartridgeChan      chan cartridge
+	requestPreimageChan      chan common.Hash
+	returnPreimageChan       chan []byte
 }
 
 func NewAPI() *nesApi {
@@ -187,10 +362,20 @@ func NewAPI() *nesApi {
 		speedChan:                make(chan float64, 64),
 		preimageChan:             make(chan preimage, 64),
 		cartridgeChan:            make(chan cartridge, 64),
+		romChan:                  make(chan []byte, 64),
+		inputConfigChan:          make(chan []byte, 64),
+		buttonChan:               make(chan button, 64),
+		eventChan:                make(chan activity.Action, 64),
+		audioChan:                make(chan *audio, 64),
+		muteChan:                 make(chan bool, 64),
+		rewindChan:               make(chan int, 64),
 		requestActivityChan:      make(chan struct{}, 64),
-		returnActivityChan:       make(chan []Action, 64),
+		returnActivityChan:       make(chan []activity.Action, 64),
 		requestCachePreimageChan: make(chan struct{}, 64),
 		returnHashChan:           make(chan common.Hash, 64),
+		returnCartridgeChan:      make(chan cartridge, 64),
+		requestPreimageChan:      make(chan common.Hash, 64),
+		returnPreimageChan:       make(chan []byte, 64),
 	}
 	js.Global().Set("NesAPI", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		return map[string]interface{}{
@@ -221,8 +406,12 @@ func NewAPI() *nesApi {
 				js.CopyBytesToGo(data, jsData)
 
 				hashInGo := common.BytesToHash(hash)
+				if crypto.Keccak256Hash(data) != hashInGo {
+					fmt.Println("[wasm] Rejected preimage with wrong hash", hashInGo)
+					return false
+				}
 				a.setPreimage(hashInGo, data)
-				return nil
+				return true
 			}),
 			"setCartridge": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 				jsStatic := args[0]
@@ -239,14 +428,106 @@ func NewAPI() *nesApi {
 				a.setCartridge(staticInGo, dynInGo)
 				return nil
 			}),
+			"setROM": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				jsData := args[0]
+				data := make([]byte, jsData.Get("byteLength").Int())
+				js.CopyBytesToGo(data, jsData)
+				a.setROM(data)
+				return nil
+			}),
+			"rewind": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				steps := 1
+				if len(args) > 0 {
+					steps = args[0].Int()
+				}
+				a.rewind(steps)
+				return nil
+			}),
+			"setButton": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				port, b := args[0].Int(), args[1].Int()
+				if port < 0 || port >= activity.Ports || b < 0 || b > 7 {
+					return false
+				}
+				a.setButton(port, b, args[2].Truthy())
+				return true
+			}),
+			"reset": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.event(activity.EventReset, 0)
+				return nil
+			}),
+			"power": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.event(activity.EventPower, 0)
+				return nil
+			}),
+			"insertDisk": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				side := args[0].Int()
+				if side < 0 || side > 255 {
+					return false
+				}
+				a.event(activity.EventDisk, uint8(side))
+				return true
+			}),
+			"setAudio": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.setAudio(NewAudio(args[0], args[1].Float()))
+				return nil
+			}),
+			"setMuted": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.setMuted(args[0].Truthy())
+				return nil
+			}),
+			"plugZapper": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.event(activity.EventZapper, 0)
+				return nil
+			}),
+			"setFourPlayer": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				adapter := args[0].Int()
+				if adapter < nes.FourPlayerNone || adapter > nes.FourPlayerFamicom {
+					return false
+				}
+				a.event(activity.EventFourPlayer, uint8(adapter))
+				return true
+			}),
+			"getEncodedActivity": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				_, actions, _ := a.getSession()
+				data, err := activity.Encode(actions)
+				if err != nil {
+					panic(err)
+				}
+				jsData := js.Global().Get("Uint8Array").New(len(data))
+				js.CopyBytesToJS(jsData, data)
+				return jsData
+			}),
+			"setInputConfig": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				a.setInputConfig([]byte(args[0].String()))
+				return nil
+			}),
+			"getPreimage": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				jsHash := args[0]
+				var hash common.Hash
+				if jsHash.Get("byteLength").Int() != len(hash) {
+					return nil
+				}
+				js.CopyBytesToGo(hash[:], jsHash)
+				data := a.getPreimage(hash)
+				if data == nil {
+					return nil
+				}
+				jsData := js.Global().Get("Uint8Array").New(len(data))
+				js.CopyBytesToJS(jsData, data)
+				return jsData
+			}),
 			"getActivity": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-				hash, activity := a.getActivity()
+				hash, actions, game := a.getSession()
 				activityJson, err := json.Marshal(struct {
 					Hash     common.Hash
-					Activity []Action
+					Activity []activity.Action
+					Static   common.Hash
+					Start    common.Hash
 				}{
 					hash,
-					activity,
+					actions,
+					game.static,
+					game.dyn,
 				})
 				if err != nil {
 					panic(err)
@@ -284,11 +565,58 @@ func (a *nesApi) setCartridge(static, dyn common.Hash) {
 	a.cartridgeChan <- cartridge{static, dyn}
 }
 
-func (a *nesApi) getActivity() (common.Hash, []Action) {
+func (a *nesApi) setROM(data []byte) {
+	a.romChan <- data
+}
+
+// rewind goes back the given number of snapshots, each rewindInterval
+// frames apart.
+func (a *nesApi) rewind(steps int) {
+	a.rewindChan <- steps
+}
+
+// setButton presses or releases a button of a controller, 0 to 3, where 2
+// and 3 are only read through a four player adapter. The first controller
+// also follows the keyboard.
+func (a *nesApi) setButton(port, b int, pressed bool) {
+	a.buttonChan <- button{port, b, pressed}
+}
+
+// event applies a console event and records it in the activity log. The
+// Zapper and the four player adapters are only plugged in by events, so that
+// the log can replay them.
+func (a *nesApi) event(event, arg uint8) {
+	a.eventChan <- activity.Action{Event: event, Button: arg}
+}
+
+// setAudio starts playing the console's audio through a ring buffer shared
+// with an AudioWorklet.
+func (a *nesApi) setAudio(audio *audio) {
+	a.audioChan <- audio
+}
+
+func (a *nesApi) setMuted(muted bool) {
+	a.muteChan <- muted
+}
+
+func (a *nesApi) setInputConfig(data []byte) {
+	a.inputConfigChan <- data
+}
+
+// getSession returns the hash of the current state, the activity that led
+// to it and the states the activity started from.
+func (a *nesApi) getSession() (common.Hash, []activity.Action, cartridge) {
 	a.requestActivityChan <- struct{}{}
 	hash := <-a.returnHashChan
 	activity := <-a.returnActivityChan
-	return hash, activity
+	game := <-a.returnCartridgeChan
+	return hash, activity, game
+}
+
+// getPreimage returns a cached preimage, or nil.
+func (a *nesApi) getPreimage(hash common.Hash) []byte {
+	a.requestPreimageChan <- hash
+	return <-a.returnPreimageChan
 }
 
 type renderer struct {
@@ -339,10 +667,11 @@ func (r *renderer) dim() {
 
 type keyboard struct {
 	keyStates map[string]bool
+	config    *input.Config
 }
 
 func NewKeyboard() *keyboard {
-	kb := &keyboard{make(map[string]bool)}
+	kb := &keyboard{make(map[string]bool), input.DefaultConfig()}
 	window := js.Global().Get("window")
 	window.Call("addEventListener", "keydown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		event := args[0]
@@ -363,76 +692,256 @@ func (kb *keyboard) isPressed(key string) bool {
 	return kb.keyStates[key]
 }
 
-func (kb *keyboard) getController() [8]bool {
-	return [8]bool{
-		kb.isPressed("KeyZ"),
-		kb.isPressed("KeyX"),
-		kb.isPressed("ShiftRight"),
-		kb.isPressed("Enter"),
-		kb.isPressed("ArrowUp"),
-		kb.isPressed("ArrowDown"),
-		kb.isPressed("ArrowLeft"),
-		kb.isPressed("ArrowRight"),
-	}
-}
-
-type MovingAverage struct {
-	index  int
-	sum    int
-	values []int
-}
-
-func NewMovingAverage(size int) *MovingAverage {
-	return &MovingAverage{values: make([]int, size)}
+// getController returns the buttons of the first controller, using the
+// keyboard profile of the input config. Inputs are KeyboardEvent codes.
+func (kb *keyboard) getController(turbo bool) [8]bool {
+	return kb.config.Keyboard.Buttons(kb.isPressed, turbo)
 }
 
-func (ma *MovingAverage) Add(value int) int {
-	ma.sum -= ma.values[ma.index]
-	ma.sum += value
-	ma.values[ma.index] = value
-	ma.index = (ma.index + 1) % len(ma.values)
-	return ma.sum / len(ma.values)
+type pointer struct {
+	x, y int
+	down bool
 }
 
-type Action struct {
-	Button   uint8
-	Press    bool
-	Duration uint32
+// NewPointer tracks the mouse or touch position over the canvas in screen
+// pixels, for the zapper.
+func NewPointer(canvas js.Value) *pointer {
+	p := &pointer{x: -1, y: -1}
+	update := func(event js.Value) {
+		width := canvas.Get("clientWidth").Float()
+		height := canvas.Get("clientHeight").Float()
+		if width == 0 || height == 0 {
+			return
+		}
+		p.x = int(event.Get("offsetX").Float() * NES_WIDTH / width)
+		p.y = int(event.Get("offsetY").Float() * NES_HEIGHT / height)
+	}
+	canvas.Call("addEventListener", "pointermove", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		update(args[0])
+		return nil
+	}))
+	canvas.Call("addEventListener", "pointerdown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		update(args[0])
+		p.down = true
+		return nil
+	}))
+	canvas.Call("addEventListener", "pointerup", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		update(args[0])
+		p.down = false
+		return nil
+	}))
+	canvas.Call("addEventListener", "pointerleave", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.x, p.y = -1, -1
+		p.down = false
+		return nil
+	}))
+	return p
 }
 
 type recorder struct {
-	buttons  [8]bool
-	activity []Action
+	buttons  [activity.Ports][8]bool
+	used     [activity.Ports]bool // the first controller is always set
+	x, y     int                  // where the zapper is aimed
+	trigger  bool
+	activity []activity.Action
+	start    uint64 // CPU cycle count when recording started
 }
 
 func NewRecorder() *recorder {
-	r := &recorder{
-		buttons:  [8]bool{},
-		activity: make([]Action, 0),
-	}
+	r := &recorder{}
 	r.reset()
 	return r
 }
 
-func (r *recorder) record(buttons [8]bool, duration uint32) {
-	if buttons != r.buttons {
-		for button, press := range buttons {
-			if press != r.buttons[button] {
-				action := Action{uint8(button), press, 0}
+// setButtons records the buttons that changed on any controller.
+func (r *recorder) setButtons(buttons [activity.Ports][8]bool) {
+	for port := range buttons {
+		for button, press := range buttons[port] {
+			if press != r.buttons[port][button] {
+				action := activity.Action{Button: uint8(button), Press: press, Port: uint8(port)}
 				r.activity = append(r.activity, action)
+				r.used[port] = true
 			}
 		}
-		r.buttons = buttons
 	}
+	r.buttons = buttons
+}
+
+// aim records a move of the zapper or of its trigger.
+func (r *recorder) aim(x, y int, trigger bool) {
+	if x == r.x && y == r.y && trigger == r.trigger {
+		return
+	}
+	action := activity.Action{Event: activity.EventAim, X: int16(x), Y: int16(y), Press: trigger}
+	r.activity = append(r.activity, action)
+	r.x, r.y, r.trigger = x, y, trigger
+}
+
+// event records a console event.
+func (r *recorder) event(action activity.Action) {
+	r.activity = append(r.activity, action)
+	if action.Event == activity.EventZapper {
+		r.x, r.y, r.trigger = -1, -1, false
+	}
+}
+
+// advance adds the cycles the console ran for to the last action.
+func (r *recorder) advance(duration uint32) {
 	r.activity[len(r.activity)-1].Duration += duration
 }
 
-func (r *recorder) getActivity() []Action {
+// truncate drops the activity after the given number of cycles.
+func (r *recorder) truncate(cycles uint64) {
+	var total uint64
+	r.buttons = [activity.Ports][8]bool{}
+	r.used = [activity.Ports]bool{true}
+	r.x, r.y, r.trigger = -1, -1, false
+	for i := range r.activity {
+		action := &r.activity[i]
+		switch action.Event {
+		case activity.EventButton:
+			if action.Button < 8 && action.Port < activity.Ports {
+				r.buttons[action.Port][action.Button] = action.Press
+				r.used[action.Port] = true
+			}
+		case activity.EventAim:
+			r.x, r.y, r.trigger = int(action.X), int(action.Y), action.Press
+		}
+		if total+uint64(action.Duration) >= cycles {
+			action.Duration = uint32(cycles - total)
+			// rewinding stops where a device was plugged in, which can be
+			// right at the end
+			var devices []activity.Action
+			for _, action := range r.activity[i+1:] {
+				if action.Event == activity.EventZapper || action.Event == activity.EventFourPlayer {
+					action.Duration = 0
+					devices = append(devices, action)
+				}
+			}
+			r.activity = r.activity[:i+1]
+			for _, action := range devices {
+				r.event(action)
+			}
+			return
+		}
+		total += uint64(action.Duration)
+	}
+}
+
+func (r *recorder) getActivity() []activity.Action {
 	return r.activity
 }
 
 func (r *recorder) reset() {
-	r.activity = make([]Action, 0)
-	nilAction := Action{0, false, 0}
+	r.buttons = [activity.Ports][8]bool{}
+	r.used = [activity.Ports]bool{true}
+	r.x, r.y, r.trigger = -1, -1, false
+	r.activity = make([]activity.Action, 0)
+	nilAction := activity.Action{}
 	r.activity = append(r.activity, nilAction)
 }
+
+// audio writes the APU's samples into a SharedArrayBuffer read by the
+// AudioWorklet in audio.js. The buffer starts with the read and write
+// indexes as two int32s, followed by the ring of float32 samples. Only the
+// worklet moves the read index and only Go moves the write index, and the
+// ring is empty when they are equal.
+type audio struct {
+	channel    chan float32
+	sampleRate float64
+	indexes    js.Value // Int32Array of the read and write indexes
+	ring       js.Value // Uint8Array of the samples
+	size       int      // samples in the ring
+	muted      bool
+	samples    []float32
+	data       []byte
+	last       float32 // last input sample, to interpolate from
+	position   float64 // position of the next output sample after last
+}
+
+func NewAudio(buffer js.Value, sampleRate float64) *audio {
+	size := (buffer.Get("byteLength").Int() - 8) / 4
+	return &audio{
+		channel:    make(chan float32, int(sampleRate)),
+		sampleRate: sampleRate,
+		indexes:    js.Global().Get("Int32Array").New(buffer, 0, 2),
+		ring:       js.Global().Get("Uint8Array").New(buffer, 8, size*4),
+		size:       size,
+	}
+}
+
+// attach sends the console's samples to the audio output.
+func (a *audio) attach(console *nes.Console) {
+	if a == nil || console == nil {
+		return
+	}
+	console.SetAudioChannel(a.channel)
+	console.SetAudioSampleRate(a.sampleRate)
+}
+
+func (a *audio) setMuted(muted bool) {
+	if a != nil {
+		a.muted = muted
+	}
+}
+
+// write moves the samples made since the last call into the ring. They are
+// resampled by the emulation speed and by a small correction that keeps the
+// ring near audioLatency seconds full, so that audio follows the video
+// instead of drifting from it. The ring's fill level is the measure of the
+// drift: it grows when the emulation runs faster than the audio device.
+func (a *audio) write(speed float64) {
+	if a == nil {
+		return
+	}
+	a.samples = a.samples[:0]
+	for len(a.channel) > 0 {
+		a.samples = append(a.samples, <-a.channel)
+	}
+	if a.muted || len(a.samples) == 0 {
+		return
+	}
+
+	atomics := js.Global().Get("Atomics")
+	read := atomics.Call("load", a.indexes, 0).Int()
+	write := atomics.Call("load", a.indexes, 1).Int()
+	fill := (write - read + a.size) % a.size
+	target := audioLatency * a.sampleRate
+	correction := (target - float64(fill)) / target
+	correction = math.Max(-1, math.Min(1, correction)) * audioMaxCorrection
+	step := speed / (1 + correction) // input samples per output sample
+
+	// linear interpolation between last and the new samples
+	a.data = a.data[:0]
+	free := a.size - 1 - fill
+	for n := len(a.samples); a.position < float64(n); a.position += step {
+		if len(a.data)/4 >= free {
+			// the ring is full: drop the rest
+			a.position = float64(n)
+			break
+		}
+		i := int(a.position)
+		f := float32(a.position - float64(i))
+		x0 := a.last
+		if i > 0 {
+			x0 = a.samples[i-1]
+		}
+		x := x0 + (a.samples[i]-x0)*f
+		bits := math.Float32bits(x)
+		a.data = append(a.data, byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24))
+	}
+	a.position -= float64(len(a.samples))
+	a.last = a.samples[len(a.samples)-1]
+
+	// copy in up to two parts, as the ring wraps around
+	first := a.data
+	if n := (a.size - write) * 4; len(first) > n {
+		first = first[:n]
+	}
+	js.CopyBytesToJS(a.ring.Call("subarray", write*4), first)
+	if rest := a.data[len(first):]; len(rest) > 0 {
+		js.CopyBytesToJS(a.ring, rest)
+	}
+	write = (write + len(a.data)/4) % a.size
+	atomics.Call("store", a.indexes, 1, write)
+}